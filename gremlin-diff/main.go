@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	cli "github.com/jawher/mow.cli"
+	logging "github.com/op/go-logging"
+	"github.com/satori/go.uuid"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+)
+
+var (
+	log = logging.MustGetLogger(os.Args[0])
+)
+
+// vertexReader returns vertices until io.EOF
+type vertexReader interface {
+	Read() (g.Vertex, error)
+}
+
+// ReadBatchSize is the number of vertices read
+// from gremlin server in one query
+const ReadBatchSize = 100
+
+// serverReader reads all vertices of a gremlin server
+// by batches of ReadBatchSize
+type serverReader struct {
+	backend  *g.ServerBackend
+	ids      []uuid.UUID
+	vertices []g.Vertex
+}
+
+func newServerReader(backend *g.ServerBackend) (*serverReader, error) {
+	ids, err := backend.VertexIDs()
+	if err != nil {
+		return nil, err
+	}
+	return &serverReader{backend: backend, ids: ids}, nil
+}
+
+func (r *serverReader) Read() (g.Vertex, error) {
+	// vertices removed since the ids were listed are not returned
+	for len(r.vertices) == 0 && len(r.ids) > 0 {
+		n := ReadBatchSize
+		if n > len(r.ids) {
+			n = len(r.ids)
+		}
+		vertices, err := r.backend.ReadVertices(r.ids[:n])
+		if err != nil {
+			return g.Vertex{}, err
+		}
+		r.ids = r.ids[n:]
+		r.vertices = vertices
+	}
+	if len(r.vertices) == 0 {
+		return g.Vertex{}, io.EOF
+	}
+	v := r.vertices[0]
+	r.vertices = r.vertices[1:]
+	return v, nil
+}
+
+// Diff is the difference between two graphs
+type Diff struct {
+	Added    []g.Vertex     `json:"added"`
+	Removed  []g.Vertex     `json:"removed"`
+	Modified []g.VertexDiff `json:"modified"`
+}
+
+// diffGraphs compares the vertices of src with the vertices of dst.
+//
+// The vertices of src are kept in memory while dst is read.
+func diffGraphs(src vertexReader, dst vertexReader) (Diff, error) {
+	d := Diff{
+		Added:    []g.Vertex{},
+		Removed:  []g.Vertex{},
+		Modified: []g.VertexDiff{},
+	}
+	vertices := make(map[uuid.UUID]g.Vertex)
+	for {
+		v, err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return d, err
+		}
+		vertices[v.ID] = v
+	}
+	for {
+		v, err := dst.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return d, err
+		}
+		sv, ok := vertices[v.ID]
+		if !ok {
+			d.Added = append(d.Added, v)
+			continue
+		}
+		delete(vertices, v.ID)
+		if vd := g.NewVertexDiff(sv, v); !vd.Empty() {
+			d.Modified = append(d.Modified, vd)
+		}
+	}
+	for _, v := range vertices {
+		d.Removed = append(d.Removed, v)
+	}
+	sort.Slice(d.Added, func(i, j int) bool {
+		return d.Added[i].ID.String() < d.Added[j].ID.String()
+	})
+	sort.Slice(d.Removed, func(i, j int) bool {
+		return d.Removed[i].ID.String() < d.Removed[j].ID.String()
+	})
+	sort.Slice(d.Modified, func(i, j int) bool {
+		return d.Modified[i].ID.String() < d.Modified[j].ID.String()
+	})
+	return d, nil
+}
+
+func formatEdge(e g.Edge) string {
+	return fmt.Sprintf("%s -%s-> %s", e.OutV, e.Label, e.InV)
+}
+
+func formatValues(values []interface{}) string {
+	if values == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprintf("%v", values)
+	}
+	return string(data)
+}
+
+func writeText(w io.Writer, d Diff) {
+	for _, v := range d.Added {
+		fmt.Fprintf(w, "+ %s/%s\n", v.Label, v.ID)
+	}
+	for _, v := range d.Removed {
+		fmt.Fprintf(w, "- %s/%s\n", v.Label, v.ID)
+	}
+	for _, vd := range d.Modified {
+		fmt.Fprintf(w, "~ %s/%s\n", vd.Label, vd.ID)
+		if vd.OldLabel != "" {
+			fmt.Fprintf(w, "    label: %s -> %s\n", vd.OldLabel, vd.Label)
+		}
+		names := make([]string, 0, len(vd.Properties))
+		for name := range vd.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pd := vd.Properties[name]
+			fmt.Fprintf(w, "    %s: %s -> %s\n", name, formatValues(pd.Old), formatValues(pd.New))
+		}
+		for _, e := range vd.AddEdges {
+			fmt.Fprintf(w, "    + %s\n", formatEdge(e))
+		}
+		for _, e := range vd.UpdateEdges {
+			fmt.Fprintf(w, "    ~ %s\n", formatEdge(e))
+		}
+		for _, e := range vd.RemoveEdges {
+			fmt.Fprintf(w, "    - %s\n", formatEdge(e))
+		}
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d modified\n",
+		len(d.Added), len(d.Removed), len(d.Modified))
+}
+
+func openDump(path string) (io.Closer, vertexReader) {
+	f, err := g.OpenGsonFile(path)
+	if err != nil {
+		log.Fatalf("Failed to open file %s: %s", path, err)
+	}
+	return f, g.NewGsonReader(f)
+}
+
+func setup(srcPath string, dstPath string, gremlinURI string, format string) {
+	var dst vertexReader
+
+	f, src := openDump(srcPath)
+	defer f.Close()
+
+	if dstPath != "" {
+		f, r := openDump(dstPath)
+		defer f.Close()
+		dst = r
+	} else {
+		log.Notice("Connecting to Gremlin Server...")
+		backend := g.NewServerBackend(gremlinURI)
+		backend.Start()
+		defer backend.Stop()
+		r, err := newServerReader(backend)
+		if err != nil {
+			log.Fatalf("Failed to list vertices: %s", err)
+		}
+		dst = r
+	}
+
+	d, err := diffGraphs(src, dst)
+	if err != nil {
+		log.Fatalf("Diff failed: %s", err)
+	}
+
+	switch strings.ToLower(format) {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			log.Fatalf("Failed to write diff: %s", err)
+		}
+	default:
+		writeText(os.Stdout, d)
+	}
+}
+
+func main() {
+	app := cli.App(os.Args[0], "Compare two GraphSON dumps or a dump with a gremlin server")
+	gremlinSrv := app.String(cli.StringOpt{
+		Name:   "gremlin",
+		Value:  "localhost:8182",
+		Desc:   "host:port of gremlin server, used when DST is not given",
+		EnvVar: "GREMLIN_DIFF_GREMLIN_SERVER",
+	})
+	format := app.String(cli.StringOpt{
+		Name:   "format",
+		Value:  "text",
+		Desc:   "output format (text or json)",
+		EnvVar: "GREMLIN_DIFF_FORMAT",
+	})
+	srcPath := app.String(cli.StringArg{
+		Name: "SRC",
+		Desc: "GraphSON dump",
+	})
+	dstPath := app.String(cli.StringArg{
+		Name: "DST",
+		Desc: "GraphSON dump compared with SRC, the gremlin server when not given",
+	})
+	utils.SetupLogging(app, log)
+	app.Action = func() {
+		gremlinURI := fmt.Sprintf("ws://%s/gremlin", *gremlinSrv)
+		setup(*srcPath, *dstPath, gremlinURI, *format)
+	}
+	app.Spec = "[OPTIONS] SRC [DST]"
+	app.Run(os.Args)
+}
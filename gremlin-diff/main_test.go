@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceReader []g.Vertex
+
+func (r *sliceReader) Read() (g.Vertex, error) {
+	if len(*r) == 0 {
+		return g.Vertex{}, io.EOF
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, nil
+}
+
+func TestDiffGraphs(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+
+	v1 := g.Vertex{ID: id1, Label: "foo"}
+	v1.AddProperty("prop1", "bar")
+	v1Updated := g.Vertex{ID: id1, Label: "foo"}
+	v1Updated.AddProperty("prop1", "baz")
+	v2 := g.Vertex{ID: id2, Label: "foo"}
+	v3 := g.Vertex{ID: id3, Label: "foo"}
+
+	src := &sliceReader{v1, v2}
+	dst := &sliceReader{v3, v1Updated}
+
+	d, err := diffGraphs(src, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, []g.Vertex{v3}, d.Added)
+	assert.Equal(t, []g.Vertex{v2}, d.Removed)
+	assert.Equal(t, 1, len(d.Modified))
+	assert.Equal(t, g.PropertyDiff{
+		Old: []interface{}{"bar"},
+		New: []interface{}{"baz"},
+	}, d.Modified[0].Properties["prop1"])
+}
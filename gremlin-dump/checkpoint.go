@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+)
+
+const (
+	// CheckpointInterval is the interval between two checkpoints of a dump
+	CheckpointInterval = 30 * time.Second
+	// CheckpointSuffix is the suffix of the checkpoint file of a dump
+	CheckpointSuffix = ".checkpoint"
+)
+
+// Checkpoint is the progress of a dump saved next to the output
+// so that an interrupted dump can be resumed
+type Checkpoint struct {
+	Compression string `json:"compression"`
+	ChunkSize   int64  `json:"chunkSize"`
+	Filter      Filter `json:"filter"`
+	Depth       int    `json:"depth"`
+	// Ranges are the token ranges left to scan
+	Ranges  []utils.TokenRange `json:"ranges,omitempty"`
+	File    g.GsonFileState    `json:"file"`
+	Backend g.GsonState        `json:"backend"`
+}
+
+// CheckpointPath returns the path of the checkpoint of a dump
+func CheckpointPath(path string) string {
+	return path + CheckpointSuffix
+}
+
+// LoadCheckpoint reads a checkpoint written by a previous dump
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	var c Checkpoint
+	file, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer file.Close()
+	dec := json.NewDecoder(file)
+	// keep edge properties of pending vertices as json.Number
+	dec.UseNumber()
+	err = dec.Decode(&c)
+	return c, err
+}
+
+// save replaces the checkpoint at path
+func (c Checkpoint) save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// checkpointer saves the progress of a dump
+type checkpointer struct {
+	path    string
+	file    *g.GsonFile
+	options Checkpoint
+	enabled bool
+}
+
+// rangeProgress tracks the token ranges left to scan.
+//
+// The start of a range is moved to the token of the last written
+// resource of the range, resources of a range being written in
+// token order.
+type rangeProgress struct {
+	ranges []utils.TokenRange
+	sync.Mutex
+}
+
+func (p *rangeProgress) set(ranges []utils.TokenRange) {
+	p.Lock()
+	defer p.Unlock()
+	p.ranges = append([]utils.TokenRange{}, ranges...)
+}
+
+func (p *rangeProgress) get() []utils.TokenRange {
+	p.Lock()
+	defer p.Unlock()
+	return append([]utils.TokenRange{}, p.ranges...)
+}
+
+func (p *rangeProgress) update(index int, token int64) {
+	p.Lock()
+	defer p.Unlock()
+	p.ranges[index].Start = token
+}
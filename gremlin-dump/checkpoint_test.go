@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "dump")
+	defer os.RemoveAll(dir)
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	pending := g.Vertex{ID: id2, Label: "bar"}
+	pending.AddInEdge(g.Edge{
+		Label:      "ref",
+		OutV:       id1,
+		Properties: map[string]g.Property{"attr": {Value: json.Number("1")}},
+	})
+
+	progress := &rangeProgress{}
+	progress.set(utils.SplitTokenRing(2))
+	progress.update(1, 42)
+
+	c := Checkpoint{
+		Compression: g.CompressionGzip,
+		Filter:      Filter{Projects: []uuid.UUID{id1}},
+		Ranges:      progress.get(),
+		Backend: g.GsonState{
+			Written: []uuid.UUID{id1},
+			Pending: []g.Vertex{pending},
+		},
+	}
+	path := CheckpointPath(filepath.Join(dir, "dump.json"))
+	assert.Nil(t, c.save(path))
+
+	c2, err := LoadCheckpoint(path)
+	assert.Nil(t, err)
+	assert.Equal(t, c, c2)
+	assert.Equal(t, int64(42), c2.Ranges[1].Start)
+}
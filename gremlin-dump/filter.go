@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/satori/go.uuid"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+)
+
+// Filter selects the resources to dump
+type Filter struct {
+	IncludeTypes   []string    `json:"includeTypes,omitempty"`
+	ExcludeTypes   []string    `json:"excludeTypes,omitempty"`
+	FQNamePrefixes [][]string  `json:"fqNamePrefixes,omitempty"`
+	Projects       []uuid.UUID `json:"projects,omitempty"`
+}
+
+// NewFilter parses the filter options. fq_name prefixes are
+// colon separated (default-domain:admin).
+func NewFilter(includeTypes []string, excludeTypes []string, fqNamePrefixes []string, projects []string) (Filter, error) {
+	f := Filter{
+		IncludeTypes: includeTypes,
+		ExcludeTypes: excludeTypes,
+	}
+	for _, prefix := range fqNamePrefixes {
+		f.FQNamePrefixes = append(f.FQNamePrefixes, strings.Split(prefix, ":"))
+	}
+	for _, project := range projects {
+		id, err := uuid.FromString(project)
+		if err != nil {
+			return f, err
+		}
+		f.Projects = append(f.Projects, id)
+	}
+	return f, nil
+}
+
+// Empty returns true when the filter selects all resources
+func (f Filter) Empty() bool {
+	return len(f.IncludeTypes) == 0 && len(f.ExcludeTypes) == 0 &&
+		len(f.FQNamePrefixes) == 0 && len(f.Projects) == 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(fqName []string, prefix []string) bool {
+	if len(fqName) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if fqName[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns true when the entry is selected by the filter.
+//
+// prefixes are the fq_name prefixes and the fq_names of the projects
+// of the filter, a resource must be under one of them.
+func (f Filter) match(e utils.FQNameEntry, prefixes [][]string) bool {
+	if len(f.IncludeTypes) > 0 && !contains(f.IncludeTypes, e.Type) {
+		return false
+	}
+	if contains(f.ExcludeTypes, e.Type) {
+		return false
+	}
+	if len(f.FQNamePrefixes) == 0 && len(f.Projects) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if hasPrefix(e.FQName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the uuids of the entries matching the filter
+func (f Filter) Select(entries []utils.FQNameEntry) []uuid.UUID {
+	prefixes := append([][]string{}, f.FQNamePrefixes...)
+	for _, project := range f.Projects {
+		found := false
+		for _, e := range entries {
+			if e.UUID == project {
+				prefixes = append(prefixes, e.FQName)
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Warningf("Project %s not found", project)
+		}
+	}
+	uuids := []uuid.UUID{}
+	for _, e := range entries {
+		if f.match(e, prefixes) {
+			uuids = append(uuids, e.UUID)
+		}
+	}
+	return uuids
+}
+
+// expansion collects the neighbours of the
+// vertices read at one level of the dump
+type expansion struct {
+	seen map[uuid.UUID]bool
+	next []uuid.UUID
+	wg   sync.WaitGroup
+	sync.Mutex
+}
+
+func newExpansion() *expansion {
+	return &expansion{
+		seen: make(map[uuid.UUID]bool),
+	}
+}
+
+// mark records uuids as already seen
+func (e *expansion) mark(uuids []uuid.UUID) {
+	e.Lock()
+	defer e.Unlock()
+	for _, id := range uuids {
+		e.seen[id] = true
+	}
+}
+
+// add records the parent and the refs of v that have not been
+// seen yet. Children and back refs are not followed, they would
+// pull most of the DB (eg: all ports of a shared network).
+func (e *expansion) add(v g.Vertex) {
+	e.Lock()
+	defer e.Unlock()
+	for _, edges := range v.OutE {
+		for _, edge := range edges {
+			e.addID(edge.InV)
+		}
+	}
+}
+
+func (e *expansion) addID(id uuid.UUID) {
+	if !e.seen[id] {
+		e.seen[id] = true
+		e.next = append(e.next, id)
+	}
+}
+
+// level returns the neighbours collected since the last call
+func (e *expansion) level() []uuid.UUID {
+	e.Lock()
+	defer e.Unlock()
+	next := e.next
+	e.next = nil
+	return next
+}
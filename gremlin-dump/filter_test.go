@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+)
+
+func TestFilterSelect(t *testing.T) {
+	projectID, _ := uuid.NewV4()
+	vnID, _ := uuid.NewV4()
+	vmiID, _ := uuid.NewV4()
+	otherID, _ := uuid.NewV4()
+
+	entries := []utils.FQNameEntry{
+		{Type: "project", FQName: []string{"default-domain", "admin"}, UUID: projectID},
+		{Type: "virtual_network", FQName: []string{"default-domain", "admin", "vn"}, UUID: vnID},
+		{Type: "virtual_machine_interface", FQName: []string{"default-domain", "admin", "vmi"}, UUID: vmiID},
+		{Type: "virtual_network", FQName: []string{"default-domain", "adminbis", "vn"}, UUID: otherID},
+	}
+
+	f, _ := NewFilter(nil, nil, nil, nil)
+	assert.True(t, f.Empty())
+	assert.Equal(t, []uuid.UUID{projectID, vnID, vmiID, otherID}, f.Select(entries))
+
+	f, _ = NewFilter([]string{"virtual_network"}, nil, nil, nil)
+	assert.Equal(t, []uuid.UUID{vnID, otherID}, f.Select(entries))
+
+	f, _ = NewFilter(nil, []string{"virtual_network"}, []string{"default-domain:admin"}, nil)
+	assert.Equal(t, []uuid.UUID{projectID, vmiID}, f.Select(entries))
+
+	f, _ = NewFilter([]string{"virtual_network"}, nil, nil, []string{projectID.String()})
+	assert.Equal(t, []uuid.UUID{vnID}, f.Select(entries))
+
+	_, err := NewFilter(nil, nil, nil, []string{"foo"})
+	assert.NotNil(t, err)
+}
+
+func TestExpansion(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+	id4, _ := uuid.NewV4()
+
+	v := g.Vertex{ID: id1}
+	v.AddOutEdge(g.Edge{Label: "ref", OutV: id1, InV: id2})
+	v.AddOutEdge(g.Edge{Label: "parent", OutV: id1, InV: id3})
+	// children are not followed
+	v.AddInEdge(g.Edge{Label: "parent", OutV: id4, InV: id1})
+
+	e := newExpansion()
+	e.mark([]uuid.UUID{id1})
+	e.add(v)
+	assert.ElementsMatch(t, []uuid.UUID{id2, id3}, e.level())
+	e.add(v)
+	assert.Empty(t, e.level())
+}
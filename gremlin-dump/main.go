@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cli "github.com/jawher/mow.cli"
@@ -21,7 +22,7 @@ var (
 )
 
 const (
-	// Readers numbers of workers reading cassandra resources
+	// Readers default number of workers reading cassandra resources
 	Readers = 10
 )
 
@@ -30,54 +31,149 @@ const (
 	ResourceRead
 	ResourceWrite
 	DuplicateVertex
+	ResourceError
 	DumpEnd
 )
 
 type Dump struct {
-	session gockle.Session
-	backend *g.GsonBackend
-	uuids   chan uuid.UUID
-	report  chan int64
-	wg      *sync.WaitGroup
+	session     gockle.Session
+	backend     *g.GsonBackend
+	uuids       chan uuid.UUID
+	report      chan int64
+	wg          *sync.WaitGroup
+	filter      Filter
+	depth       int
+	expand      *expansion
+	parallelism int
+	read        *int64
+	progress    *rangeProgress
+	checkpoint  *checkpointer
+	// written are the resources written before the dump was resumed
+	written map[uuid.UUID]bool
 }
 
-func NewDump(session gockle.Session, output io.Writer) Dump {
+func NewDump(session gockle.Session, output io.Writer, deterministic bool, filter Filter, depth int, parallelism int) Dump {
 	d := Dump{
-		session: session,
-		backend: g.NewGsonBackend(output),
-		uuids:   make(chan uuid.UUID),
-		report:  make(chan int64),
-		wg:      &sync.WaitGroup{},
+		session:     session,
+		backend:     g.NewGsonBackend(output),
+		uuids:       make(chan uuid.UUID),
+		report:      make(chan int64),
+		wg:          &sync.WaitGroup{},
+		filter:      filter,
+		depth:       depth,
+		parallelism: parallelism,
+		read:        new(int64),
+		progress:    &rangeProgress{},
+		checkpoint:  &checkpointer{},
+		written:     make(map[uuid.UUID]bool),
 	}
+	if !filter.Empty() {
+		d.expand = newExpansion()
+	}
+	d.backend.SetDeterministic(deterministic)
 	d.backend.Start()
 	return d
 }
 
+// SetCheckpoint saves the progress of the dump to path
+// every CheckpointInterval and when the dump fails
+func (d Dump) SetCheckpoint(path string, file *g.GsonFile, options Checkpoint) {
+	d.checkpoint.path = path
+	d.checkpoint.file = file
+	d.checkpoint.options = options
+	d.checkpoint.enabled = true
+}
+
+// Resume continues the dump saved in c
+func (d Dump) Resume(c Checkpoint) error {
+	d.progress.set(c.Ranges)
+	for _, id := range c.Backend.Written {
+		d.written[id] = true
+	}
+	return d.backend.Restore(c.Backend)
+}
+
 func (d Dump) Start() {
 	go d.reportCount()
-	for w := 1; w <= Readers; w++ {
-		go d.processResource()
+	// a full dump is read by the parallel scan, workers
+	// only read the resources selected by the filter
+	if !d.filter.Empty() {
+		for w := 1; w <= d.parallelism; w++ {
+			go d.processResource()
+		}
 	}
+	stop := make(chan bool)
+	done := make(chan bool)
+	go d.checkpointLoop(stop, done)
 	start := time.Now()
 	d.report <- DumpStart
 	err := d.getResources()
 	if err != nil {
-		log.Panicf("Dump failed: %s", err)
+		if d.checkpoint.enabled {
+			close(stop)
+			<-done
+			if err := d.saveCheckpoint(); err != nil {
+				log.Errorf("Failed to save checkpoint: %s", err)
+			}
+			fmt.Println()
+			log.Fatalf("Dump failed: %s, run again with --resume to continue", err)
+		}
+		log.Fatalf("Dump failed: %s", err)
 	}
 	end := time.Now().Sub(start)
 	d.report <- DumpEnd
 	d.wg.Wait()
+	close(stop)
+	<-done
 	d.backend.Stop()
 	fmt.Println()
-	log.Noticef("Dump done in %0.2fs", end.Seconds())
+	log.Noticef("Dump done in %0.2fs (%0.0f resources/s)", end.Seconds(),
+		float64(atomic.LoadInt64(d.read))/end.Seconds())
+}
+
+func (d Dump) checkpointLoop(stop chan bool, done chan bool) {
+	defer close(done)
+	if !d.checkpoint.enabled {
+		return
+	}
+	ticker := time.NewTicker(CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.saveCheckpoint(); err != nil {
+				log.Errorf("Failed to save checkpoint: %s", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// saveCheckpoint saves the state of the backend and of
+// the output file between two writes
+func (d Dump) saveCheckpoint() error {
+	return d.backend.Checkpoint(func(s g.GsonState) error {
+		fs, err := d.checkpoint.file.Checkpoint()
+		if err != nil {
+			return err
+		}
+		c := d.checkpoint.options
+		c.Ranges = d.progress.get()
+		c.File = fs
+		c.Backend = s
+		return c.save(d.checkpoint.path)
+	})
 }
 
 func (d Dump) reportCount() {
 	readCount := 0
 	writeCount := 0
 	duplicateCount := 0
+	errorCount := 0
 
 	dumpStatus := `W`
+	start := time.Now()
 
 	for c := range d.report {
 		switch c {
@@ -87,13 +183,17 @@ func (d Dump) reportCount() {
 			writeCount++
 		case DuplicateVertex:
 			duplicateCount++
+		case ResourceError:
+			errorCount++
 		case DumpStart:
 			dumpStatus = `R`
+			start = time.Now()
 		case DumpEnd:
 			dumpStatus = `D`
 		}
-		fmt.Printf("\rProcessing [read:%d write:%d dup:%d] %s",
-			readCount, writeCount, duplicateCount, dumpStatus)
+		fmt.Printf("\rProcessing [read:%d write:%d dup:%d err:%d] %0.0f/s %s",
+			readCount, writeCount, duplicateCount, errorCount,
+			float64(readCount)/time.Since(start).Seconds(), dumpStatus)
 	}
 }
 
@@ -101,61 +201,257 @@ func (d Dump) processResource() {
 	d.wg.Add(1)
 	defer d.wg.Done()
 	for uuid := range d.uuids {
-		vertex, err := utils.GetContrailResource(d.session, uuid)
-		if err != nil {
-			log.Warningf("%s", err)
-		} else {
-			d.report <- ResourceRead
-			err := d.backend.Create(vertex)
-			if err != nil {
-				d.report <- DuplicateVertex
-			} else {
-				d.report <- ResourceWrite
-			}
+		d.readResource(uuid)
+		if d.expand != nil {
+			d.expand.wg.Done()
 		}
 	}
 }
 
+// readResource reads and writes a selected resource. Resources
+// written before the dump was resumed are not written again, they
+// are only read to find their neighbours.
+func (d Dump) readResource(id uuid.UUID) {
+	written := d.written[id]
+	if written && d.depth == 0 {
+		return
+	}
+	vertex, err := utils.GetContrailResource(d.session, id)
+	if err != nil {
+		log.Warningf("%s", err)
+		d.report <- ResourceError
+		return
+	}
+	if d.expand != nil {
+		d.expand.add(vertex)
+	}
+	if !written {
+		d.writeResource(vertex)
+	}
+}
+
+func (d Dump) writeResource(vertex g.Vertex) {
+	atomic.AddInt64(d.read, 1)
+	d.report <- ResourceRead
+	err := d.backend.Create(vertex)
+	if err != nil {
+		d.report <- DuplicateVertex
+	} else {
+		d.report <- ResourceWrite
+	}
+}
+
 func (d Dump) getResources() error {
 	defer close(d.uuids)
-	err := utils.GetContrailUUIDs(d.session, d.uuids)
+	if d.filter.Empty() {
+		return d.scanResources()
+	}
+	uuids, err := d.selectResources()
 	if err != nil {
 		return err
 	}
+	d.expand.mark(uuids)
+	// neighbours of the selected resources are read level by level,
+	// the ones that are not read are written as missing vertices
+	for level := 0; len(uuids) > 0; level++ {
+		d.expand.wg.Add(len(uuids))
+		for _, id := range uuids {
+			d.uuids <- id
+		}
+		if level == d.depth {
+			break
+		}
+		d.expand.wg.Wait()
+		uuids = d.expand.level()
+	}
 	return nil
 }
 
-func setup(cassandraCluster []string, filePath string) {
+// scanResources reads all resources with a parallel
+// scan of obj_uuid_table
+func (d Dump) scanResources() error {
 	var (
-		session gockle.Session
-		err     error
+		ranges    = d.progress.get()
+		resources = make(chan utils.ScannedResource)
+		done      = make(chan bool)
 	)
+	if len(ranges) == 0 {
+		ranges = utils.SplitTokenRing(d.parallelism)
+		d.progress.set(ranges)
+	}
+	go func() {
+		for r := range resources {
+			if r.Err != nil {
+				log.Warningf("%s", r.Err)
+				d.report <- ResourceError
+			} else {
+				d.writeResource(r.Vertex)
+			}
+			d.progress.update(r.Range, r.Token)
+		}
+		done <- true
+	}()
+	err := utils.ScanContrailResources(d.session, ranges, resources)
+	close(resources)
+	<-done
+	return err
+}
+
+// selectResources returns the uuids of the resources matching the filter
+func (d Dump) selectResources() ([]uuid.UUID, error) {
+	var (
+		entries = []utils.FQNameEntry{}
+		ch      = make(chan utils.FQNameEntry)
+		done    = make(chan bool)
+	)
+	go func() {
+		for e := range ch {
+			entries = append(entries, e)
+		}
+		done <- true
+	}()
+	err := utils.GetContrailFQNames(d.session, ch)
+	close(ch)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+	return d.filter.Select(entries), nil
+}
+
+func setup(cassandraConfig utils.CassandraConfig, filePath string, deterministic bool, compression string, chunkSize int64,
+	filter Filter, depth int, parallelism int, resume bool) {
+	var (
+		session        gockle.Session
+		f              *g.GsonFile
+		checkpoint     Checkpoint
+		checkpointPath = CheckpointPath(filePath)
+		err            error
+	)
+
+	if resume && deterministic {
+		log.Fatal("A deterministic dump can't be resumed")
+	}
 
 	log.Notice("Connecting to Cassandra...")
-	session, err = utils.SetupCassandra(cassandraCluster)
+	session, err = utils.SetupCassandra(cassandraConfig)
 	if err != nil {
 		log.Fatalf("Failed to connect to Cassandra: %s", err)
 	}
 	log.Notice("Connected.")
 	defer session.Close()
 
-	f, err := os.Create(filePath)
+	if resume {
+		checkpoint, err = LoadCheckpoint(checkpointPath)
+		if err != nil {
+			log.Fatalf("Failed to read checkpoint %s: %s", checkpointPath, err)
+		}
+		// the dump continues with the options of the interrupted dump
+		compression, chunkSize = checkpoint.Compression, checkpoint.ChunkSize
+		filter, depth = checkpoint.Filter, checkpoint.Depth
+		f, err = g.ResumeGsonFile(filePath, compression, chunkSize, checkpoint.File)
+	} else {
+		if compression == "auto" {
+			compression = g.CompressionFromPath(filePath)
+		}
+		checkpoint = Checkpoint{
+			Compression: compression,
+			ChunkSize:   chunkSize,
+			Filter:      filter,
+			Depth:       depth,
+		}
+		f, err = g.CreateGsonFile(filePath, compression, chunkSize)
+	}
 	if err != nil {
 		log.Fatalf("Failed to open file %s: %s", filePath, err)
 	}
-	defer f.Close()
 
-	d := NewDump(session, f)
+	d := NewDump(session, f, deterministic, filter, depth, parallelism)
+	if !deterministic {
+		d.SetCheckpoint(checkpointPath, f, checkpoint)
+	}
+	if resume {
+		if err := d.Resume(checkpoint); err != nil {
+			log.Fatalf("Failed to resume dump: %s", err)
+		}
+		log.Noticef("Resuming dump, %d resources already written", len(checkpoint.Backend.Written))
+	}
 	d.Start()
+
+	if err := f.Close(); err != nil {
+		log.Fatalf("Failed to write file %s: %s", filePath, err)
+	}
+	if chunkSize > 0 {
+		log.Noticef("Chunks listed in %s", g.ManifestPath(filePath))
+	}
+	if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+		log.Warningf("Failed to remove checkpoint %s: %s", checkpointPath, err)
+	}
 }
 
 func main() {
 	app := cli.App(os.Args[0], "Dump Contrail DB to GraphSON file")
-	cassandraSrvs := app.Strings(cli.StringsOpt{
-		Name:   "cassandra",
-		Value:  []string{"localhost"},
-		Desc:   "list of host of cassandra nodes, uses CQL port 9042",
-		EnvVar: "GREMLIN_DUMP_CASSANDRA_SERVERS",
+	cassandraConfig := utils.CassandraOptions(app, "GREMLIN_DUMP")
+	setupTransforms := utils.TransformOptions(app, "GREMLIN_DUMP")
+	parallelism := app.Int(cli.IntOpt{
+		Name:   "parallelism",
+		Value:  Readers,
+		Desc:   "number of token ranges scanned in parallel, or of workers reading filtered resources",
+		EnvVar: "GREMLIN_DUMP_PARALLELISM",
+	})
+	deterministic := app.Bool(cli.BoolOpt{
+		Name:   "deterministic",
+		Value:  false,
+		Desc:   "write the same file for the same DB content (vertices are kept in memory)",
+		EnvVar: "GREMLIN_DUMP_DETERMINISTIC",
+	})
+	compression := app.String(cli.StringOpt{
+		Name:   "compression",
+		Value:  "auto",
+		Desc:   "compression of the output (auto, none, gzip or zstd), auto uses the file extension (.gz or .zst)",
+		EnvVar: "GREMLIN_DUMP_COMPRESSION",
+	})
+	chunkSize := app.Int(cli.IntOpt{
+		Name:   "chunk-size",
+		Value:  0,
+		Desc:   "split the dump in chunks of this size in MB (before compression), 0 to disable",
+		EnvVar: "GREMLIN_DUMP_CHUNK_SIZE",
+	})
+	includeTypes := app.Strings(cli.StringsOpt{
+		Name:   "include-type",
+		Value:  []string{},
+		Desc:   "only dump resources of these types",
+		EnvVar: "GREMLIN_DUMP_INCLUDE_TYPES",
+	})
+	excludeTypes := app.Strings(cli.StringsOpt{
+		Name:   "exclude-type",
+		Value:  []string{},
+		Desc:   "don't dump resources of these types",
+		EnvVar: "GREMLIN_DUMP_EXCLUDE_TYPES",
+	})
+	fqNamePrefixes := app.Strings(cli.StringsOpt{
+		Name:   "fq-name-prefix",
+		Value:  []string{},
+		Desc:   "only dump resources under these fq_names (eg: default-domain:admin)",
+		EnvVar: "GREMLIN_DUMP_FQ_NAME_PREFIXES",
+	})
+	projects := app.Strings(cli.StringsOpt{
+		Name:   "project",
+		Value:  []string{},
+		Desc:   "only dump resources of these project uuids",
+		EnvVar: "GREMLIN_DUMP_PROJECTS",
+	})
+	depth := app.Int(cli.IntOpt{
+		Name:   "depth",
+		Value:  0,
+		Desc:   "also dump neighbours of filtered resources up to this number of parent/ref hops",
+		EnvVar: "GREMLIN_DUMP_DEPTH",
+	})
+	resume := app.Bool(cli.BoolOpt{
+		Name:   "resume",
+		Value:  false,
+		Desc:   "continue an interrupted dump from its checkpoint, the options of the interrupted dump are used",
+		EnvVar: "GREMLIN_DUMP_RESUME",
 	})
 	filePath := app.String(cli.StringArg{
 		Name: "DST",
@@ -163,7 +459,17 @@ func main() {
 	})
 	utils.SetupLogging(app, log)
 	app.Action = func() {
-		setup(*cassandraSrvs, *filePath)
+		filter, err := NewFilter(*includeTypes, *excludeTypes, *fqNamePrefixes, *projects)
+		if err != nil {
+			log.Fatalf("Invalid project uuid: %s", err)
+		}
+		config, err := cassandraConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		setupTransforms()
+		setup(config, *filePath, *deterministic, *compression, int64(*chunkSize)*1024*1024,
+			filter, *depth, *parallelism, *resume)
 	}
 	app.Run(os.Args)
 }
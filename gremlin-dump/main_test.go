@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/willfaught/gockle"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+)
+
+type fqNameIterator struct {
+	rows []string
+	idx  *int
+}
+
+func (i fqNameIterator) Close() error {
+	return nil
+}
+
+func (i fqNameIterator) Scan(results ...interface{}) bool {
+	if *i.idx >= len(i.rows) {
+		return false
+	}
+	*results[0].(*string) = i.rows[*i.idx]
+	*i.idx++
+	return true
+}
+
+func (i fqNameIterator) ScanMap(results map[string]interface{}) bool {
+	return false
+}
+
+// dumpedVertex is the part of a written vertex checked by the tests
+type dumpedVertex struct {
+	ID struct {
+		Value string `json:"@value"`
+	} `json:"id"`
+	InE map[string][]interface{} `json:"inE"`
+}
+
+func TestResumeFiltered(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+
+	query := "SELECT key, column1, value FROM obj_uuid_table WHERE key=?"
+	resources := map[uuid.UUID][]map[string]interface{}{
+		id1: {
+			{"column1": []byte("type"), "value": `"foo"`},
+			{"column1": []byte("fq_name"), "value": `["foo1"]`},
+			{"column1": []byte("ref:bar:" + id3.String()), "value": `{"attr": null}`},
+		},
+		id2: {
+			{"column1": []byte("type"), "value": `"foo"`},
+			{"column1": []byte("fq_name"), "value": `["foo2"]`},
+		},
+		id3: {
+			{"column1": []byte("type"), "value": `"bar"`},
+			{"column1": []byte("fq_name"), "value": `["bar"]`},
+			{"column1": []byte("backref:foo:" + id1.String()), "value": `{"attr": null}`},
+		},
+	}
+
+	// foo1 was written before the dump was interrupted,
+	// its ref to bar is pending
+	pending := g.Vertex{ID: id3, Label: "bar"}
+	pending.AddInEdge(g.Edge{Label: "ref", OutV: id1, OutVLabel: "foo"})
+
+	for depth, read := range map[int]int64{0: 1, 1: 2} {
+		session := &gockle.SessionMock{}
+		session.When("ScanIterator", "SELECT column1 FROM obj_fq_name_table", []interface{}(nil)).Return(
+			fqNameIterator{
+				rows: []string{
+					"foo:foo1:" + id1.String(),
+					"foo:foo2:" + id2.String(),
+					"bar:bar:" + id3.String(),
+				},
+				idx: new(int),
+			},
+		)
+		for id, rows := range resources {
+			session.When("ScanMapSlice", query, []interface{}{id.String()}).Return(rows, nil)
+		}
+
+		var output bytes.Buffer
+		filter := Filter{IncludeTypes: []string{"foo"}}
+		d := NewDump(session, &output, false, filter, depth, 2)
+		err := d.Resume(Checkpoint{
+			Filter: filter,
+			Depth:  depth,
+			Backend: g.GsonState{
+				Written: []uuid.UUID{id1},
+				Pending: []g.Vertex{pending},
+			},
+		})
+		assert.Nil(t, err)
+		d.Start()
+
+		// foo1 is not written again
+		assert.Equal(t, read, *d.read, "depth %d", depth)
+		vertices := map[string]dumpedVertex{}
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			var v dumpedVertex
+			assert.Nil(t, json.Unmarshal([]byte(line), &v))
+			vertices[v.ID.Value] = v
+		}
+		assert.Equal(t, 2, len(vertices), "depth %d", depth)
+		assert.Contains(t, vertices, id2.String(), "depth %d", depth)
+		assert.Equal(t, 1, len(vertices[id3.String()].InE["ref"]), "depth %d", depth)
+	}
+}
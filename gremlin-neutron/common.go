@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/eonpatapon/gremlin"
+	"github.com/satori/go.uuid"
 )
 
 type gremlinQuery struct {
@@ -104,6 +107,32 @@ func filterQuery(query *gremlinQuery, bindings gremlin.Bind, filters map[string]
 	}
 }
 
+// ownerQuery keeps the resources visible by the tenant of
+// a user context
+type ownerQuery func(query *gremlinQuery, bindings gremlin.Bind, c RequestContext)
+
+// projectOwnerQuery keeps the resources of the
+// project of the tenant that are user visible
+func projectOwnerQuery(query *gremlinQuery, bindings gremlin.Bind, c RequestContext) {
+	query.Add(`.where(__.out('parent').has(id, _tenant_id))`)
+	query.Add(`.where(values('id_perms').select('user_visible').is(true))`)
+	bindings["_tenant_id"] = c.TenantID
+}
+
+// readQuery starts the query of the resource id with the given label.
+// Missing and deleted resources are skipped. It returns false when id
+// is not a valid resource id.
+func readQuery(query *gremlinQuery, bindings gremlin.Bind, label string, id string) bool {
+	rUUID, err := uuid.FromString(id)
+	if err != nil {
+		return false
+	}
+	query.Addf(`g.V(_id).hasLabel('%s')`, label)
+	query.Add(`.not(has('_missing')).not(has('deleted', neq(0)))`)
+	bindings["_id"] = rUUID
+	return true
+}
+
 func valuesQuery(query *gremlinQuery, fields []string, defaultFields []string, f func(*gremlinQuery, string)) {
 	// Check that requested fields have an implementation
 	validatedFields := validateFields(fields, defaultFields)
@@ -140,3 +169,233 @@ func valuesQuery(query *gremlinQuery, fields []string, defaultFields []string, f
 		}
 	}
 }
+
+// selectFields returns the given fields of the JSON
+// representation of resource
+func selectFields(resource interface{}, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	res := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := values[field]; ok {
+			res[field] = value
+		}
+	}
+	return res, nil
+}
+
+// matchFilters checks filters against the JSON representation
+// of resource, for resources that are not vertices
+func matchFilters(resource interface{}, filters RequestFilters) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return false
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return false
+	}
+	for key, filterValues := range filters {
+		value, ok := values[key]
+		if !ok {
+			log.Warningf("No implementation for filter %s", key)
+			continue
+		}
+		found := false
+		for _, filterValue := range filterValues {
+			if fmt.Sprintf("%v", filterValue) == fmt.Sprintf("%v", value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// unfoldFields replaces the values of fields in the results of a
+// query by their first element or null. Optional values are folded
+// in queries because gremlin server can't return null values.
+func unfoldFields(res []byte, fields ...string) ([]byte, error) {
+	var results []map[string]json.RawMessage
+	if err := json.Unmarshal(res, &results); err != nil {
+		return []byte{}, err
+	}
+	for _, result := range results {
+		for _, field := range fields {
+			value, ok := result[field]
+			if !ok {
+				continue
+			}
+			var values []json.RawMessage
+			if err := json.Unmarshal(value, &values); err != nil {
+				return []byte{}, err
+			}
+			if len(values) == 0 {
+				result[field] = json.RawMessage("null")
+			} else {
+				result[field] = values[0]
+			}
+		}
+	}
+	return json.Marshal(results)
+}
+
+// unsortableFields are the list fields of the resources
+// that can't be used as sort keys
+var unsortableFields = []string{
+	"security_groups",
+	"fixed_ips",
+	"allowed_address_pairs",
+	"extra_dhcp_opts",
+	"binding:vif_details",
+	"subnets",
+	"external_gateway_info",
+}
+
+// sortKeys returns the sort keys of a list request with their
+// order (incr or decr). Like neutron, id is added as the last
+// key so that the order of paginated results is stable.
+func sortKeys(data RequestData, defaultFields []string) (keys []string, orders []string) {
+	for i, key := range data.SortKey {
+		if !hasField(defaultFields, key) || hasField(unsortableFields, key) {
+			log.Warningf("No implementation for sort key %s", key)
+			continue
+		}
+		order := "incr"
+		if i < len(data.SortDir) && data.SortDir[i] == "desc" {
+			order = "decr"
+		}
+		keys = append(keys, key)
+		orders = append(orders, order)
+	}
+	if !hasField(keys, "id") {
+		keys = append(keys, "id")
+		orders = append(orders, "incr")
+	}
+	return keys, orders
+}
+
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// sortValue returns the value of a sort key projected by
+// paginationQuery. Values are compared with their type (eg:
+// booleans, numbers), ids are compared as strings like in the
+// neutron db (ids are UUIDs in the graph). Optional values are
+// folded, an empty value is sorted first.
+func sortValue(key string) string {
+	return fmt.Sprintf(`coalesce(
+		select('%s').unfold().map{ UUID.isInstance(it.get()) ? it.get().toString() : it.get() },
+		constant('')
+	)`, key)
+}
+
+// markerQuery keeps the resources that are sorted after the
+// marker. Like neutron, a resource is after the marker when its
+// first different sort key is greater (or lower in decr order)
+// than the one of the marker.
+func markerQuery(query *gremlinQuery, keys []string, orders []string) {
+	conditions := make([]string, len(keys))
+	for i, key := range keys {
+		steps := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			steps = append(steps, fmt.Sprintf(`__.%s.is(eq(_marker_%d))`, sortValue(keys[j]), j))
+		}
+		compare := "gt"
+		if orders[i] == "decr" {
+			compare = "lt"
+		}
+		steps = append(steps, fmt.Sprintf(`__.%s.is(%s(_marker_%d))`, sortValue(key), compare, i))
+		conditions[i] = fmt.Sprintf(`__.and(%s)`, strings.Join(steps, ","))
+	}
+	query.Addf(`.or(%s)`, strings.Join(conditions, ","))
+}
+
+// paginationQuery sorts the resources of query, skips the resources
+// up to the marker and limits the number of resources. Only the sort
+// keys are projected with values before the resources are sorted, so
+// that the other fields are computed for the returned page only. The
+// sort keys of the marker are read first, notFound is returned when
+// the marker is not a resource with the given label or is not
+// visible by the tenant (owner filters the resources of a tenant
+// like the list query).
+func paginationQuery(app *App, query *gremlinQuery, bindings gremlin.Bind, r Request, label string, notFound error,
+	defaultFields []string, values func(*gremlinQuery, []string), owner ownerQuery) error {
+	data := r.Data
+	if !data.paginated() {
+		return nil
+	}
+	keys, orders := sortKeys(data, defaultFields)
+	query.Add(`.as('_resource')`)
+	values(query, keys)
+	if data.Marker != "" {
+		markerValues, err := readMarker(app, r.Context, data.Marker, label, notFound, owner, keys, values)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			bindings[fmt.Sprintf("_marker_%d", i)] = markerValues[key]
+		}
+		markerQuery(query, keys, orders)
+	}
+	query.Add(`.order()`)
+	for i, key := range keys {
+		query.Addf(`.by(%s, %s)`, sortValue(key), orders[i])
+	}
+	if data.Limit > 0 {
+		query.Add(`.limit(_limit)`)
+		bindings["_limit"] = data.Limit
+	}
+	query.Add(`.select('_resource')`)
+	return nil
+}
+
+// readMarker returns the values of the sort keys of the marker
+func readMarker(app *App, c RequestContext, marker string, label string, notFound error, owner ownerQuery,
+	keys []string, values func(*gremlinQuery, []string)) (map[string]interface{}, error) {
+	var (
+		query    = &gremlinQuery{}
+		bindings = gremlin.Bind{}
+	)
+	if !readQuery(query, bindings, label, marker) {
+		return nil, notFound
+	}
+	if !c.IsAdmin {
+		owner(query, bindings, c)
+	}
+	values(query, keys)
+	query.Addf(`.project(%s)`, fieldsToProject(keys))
+	for _, key := range keys {
+		query.Addf(`.by(%s)`, sortValue(key))
+	}
+	res, err := app.executeOne(query, bindings, notFound)
+	if err != nil {
+		return nil, err
+	}
+	// numbers are kept as they are in the graph
+	var markerValues map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(res))
+	dec.UseNumber()
+	if err := dec.Decode(&markerValues); err != nil {
+		return nil, err
+	}
+	return markerValues, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/eonpatapon/gremlin"
+)
+
+var floatingIPDefaultFields = []string{
+	"id",
+	"tenant_id",
+	"floating_ip_address",
+	"floating_network_id",
+	"fixed_ip_address",
+	"port_id",
+	"router_id",
+	"status",
+	"description",
+	"created_at",
+	"updated_at",
+}
+
+func listFloatingIPs(r Request, app *App) ([]byte, error) {
+	var (
+		query    = &gremlinQuery{}
+		bindings = gremlin.Bind{}
+	)
+
+	// The project of a floating ip is a ref, the parent
+	// is the floating ip pool
+	if r.Context.IsAdmin {
+		query.Add(`g.V().hasLabel('floating_ip')`)
+	} else {
+		query.Add(`g.V(_tenant_id).in('ref').hasLabel('floating_ip')`)
+		query.Add(`.where(values('id_perms').select('user_visible').is(true))`)
+		bindings["_tenant_id"] = r.Context.TenantID
+	}
+
+	filterQuery(query, bindings, r.Data.Filters,
+		func(query *gremlinQuery, key string, valuesQuery string) {
+			switch key {
+			case "tenant_id":
+				// Add this filter only in admin context, because in user context
+				// the collection is already filtered above.
+				if r.Context.IsAdmin {
+					query.Addf(`.where(__.out('ref').hasLabel('project').has(id, %s))`, valuesQuery)
+				}
+			case "floating_ip_address":
+				query.Addf(`.has('floating_ip_address', %s)`, valuesQuery)
+			case "fixed_ip_address":
+				query.Addf(`.has('floating_ip_fixed_ip_address', %s)`, valuesQuery)
+			case "floating_network_id":
+				query.Addf(`.where(__.out('parent').out('parent').has(id, %s))`, valuesQuery)
+			case "port_id":
+				query.Addf(`.where(__.out('ref').hasLabel('virtual_machine_interface').has(id, %s))`, valuesQuery)
+			default:
+				log.Warningf("No implementation for filter %s", key)
+			}
+		})
+
+	notFound := newNotFoundError("FloatingIPNotFound", "floatingip_id", r.Data.Marker)
+	if err := paginationQuery(app, query, bindings, r, "floating_ip", notFound,
+		floatingIPDefaultFields, floatingIPValuesQuery, floatingIPOwnerQuery); err != nil {
+		return []byte{}, err
+	}
+
+	floatingIPValuesQuery(query, r.Data.Fields)
+
+	res, err := app.execute(query, bindings)
+	if err != nil {
+		return []byte{}, err
+	}
+	return unfoldFields(res, "floating_network_id", "fixed_ip_address", "port_id", "router_id")
+}
+
+// floatingIPOwnerQuery keeps the floating ips
+// that ref the project of the tenant
+func floatingIPOwnerQuery(query *gremlinQuery, bindings gremlin.Bind, c RequestContext) {
+	query.Add(`.where(__.out('ref').hasLabel('project').has(id, _tenant_id))`)
+	query.Add(`.where(values('id_perms').select('user_visible').is(true))`)
+	bindings["_tenant_id"] = c.TenantID
+}
+
+func floatingIPValuesQuery(query *gremlinQuery, fields []string) {
+	valuesQuery(query, fields, floatingIPDefaultFields,
+		func(query *gremlinQuery, field string) {
+			switch field {
+			case "tenant_id":
+				query.Add(`.by(
+					coalesce(
+						__.out('ref').hasLabel('project').id().map{ it.get().toString().replace('-', '') },
+						constant('')
+					)
+				)`)
+			case "floating_ip_address":
+				query.Add(`.by(values('floating_ip_address'))`)
+			case "floating_network_id":
+				// The pool may be missing if the resource is incomplete
+				query.Add(`.by(__.out('parent').out('parent').id().fold())`)
+			case "fixed_ip_address":
+				query.Add(`.by(values('floating_ip_fixed_ip_address').fold())`)
+			case "port_id":
+				query.Add(`.by(__.out('ref').hasLabel('virtual_machine_interface').id().limit(1).fold())`)
+			case "router_id":
+				// The router that has an interface in the network of the port
+				query.Add(`.by(
+					__.out('ref').hasLabel('virtual_machine_interface').limit(1)
+						.out('ref').hasLabel('virtual_network')
+						.in('ref').hasLabel('virtual_machine_interface')
+						.in('ref').hasLabel('logical_router')
+						.dedup().id().limit(1).fold()
+				)`)
+			case "status":
+				query.Add(`.by(
+					choose(
+						__.out('ref').hasLabel('virtual_machine_interface'),
+						constant('ACTIVE'),
+						constant('DOWN')
+					)
+				)`)
+			}
+		})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type floatingIP struct {
+	ID                uuid.UUID  `json:"id"`
+	TenantID          string     `json:"tenant_id"`
+	FloatingIPAddress string     `json:"floating_ip_address"`
+	FloatingNetworkID uuid.UUID  `json:"floating_network_id"`
+	FixedIPAddress    *string    `json:"fixed_ip_address"`
+	PortID            *uuid.UUID `json:"port_id"`
+	RouterID          *uuid.UUID `json:"router_id"`
+	Status            string     `json:"status"`
+}
+
+func makeFloatingIPRequest(tenantID string, isAdmin bool, data RequestData) *http.Response {
+	return makeRequest("floatingip", ListRequest, tenantID, isAdmin, data)
+}
+
+func parseFloatingIPs(resp *http.Response) (fips []floatingIP) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &fips)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return fips
+}
+
+func TestFloatingIPListUser(t *testing.T) {
+	resp := makeFloatingIPRequest(tenantID, false, RequestData{})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	fips := parseFloatingIPs(resp)
+	assert.Equal(t, 5, len(fips))
+}
+
+func TestFloatingIPListAdmin(t *testing.T) {
+	resp := makeFloatingIPRequest(tenantID, true, RequestData{})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	fips := parseFloatingIPs(resp)
+	assert.Equal(t, 20, len(fips))
+}
+
+func TestFloatingIPListUserFilterPort(t *testing.T) {
+	resp := makeFloatingIPRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"port_id": []interface{}{"ec12373a-7452-4a51-af9c-5cd9cfb48513"},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	fips := parseFloatingIPs(resp)
+	assert.Equal(t, 1, len(fips))
+	fip := fips[0]
+	assert.Equal(t, "053e5abc-462a-40a6-ae04-b09b569709e5", fip.ID.String())
+	assert.Equal(t, tenantID, fip.TenantID)
+	assert.Equal(t, "84.39.62.110", fip.FloatingIPAddress)
+	assert.Equal(t, "50360408-700d-4af9-a8ca-14307ccc1834", fip.FloatingNetworkID.String())
+	assert.Equal(t, "15.15.15.5", *fip.FixedIPAddress)
+	assert.Equal(t, "ec12373a-7452-4a51-af9c-5cd9cfb48513", fip.PortID.String())
+	assert.Equal(t, "3647b23e-f261-45ec-80fe-be21fc868df6", fip.RouterID.String())
+	assert.Equal(t, "ACTIVE", fip.Status)
+}
+
+func TestFloatingIPListUserFields(t *testing.T) {
+	resp := makeFloatingIPRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"floating_ip_address": []interface{}{"84.39.62.110"},
+		},
+		Fields: []string{"id", "floating_ip_address"},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	fips := parseFloatingIPs(resp)
+	assert.Equal(t, 1, len(fips))
+	assert.Nil(t, fips[0].PortID)
+}
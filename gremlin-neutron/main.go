@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -26,17 +27,78 @@ var (
 	quit       = make(chan bool, 1)
 	closed     = make(chan bool, 1)
 	allImplems = map[string]func(Request, *App) ([]byte, error){
-		"READALL_port":    listPorts,
-		"READALL_network": listNetworks,
+		"READALL_port":                listPorts,
+		"READALL_network":             listNetworks,
+		"READ_port":                   readPort,
+		"READ_network":                readNetwork,
+		"READALL_subnet":              listSubnets,
+		"READ_subnet":                 readSubnet,
+		"READALL_security_group":      listSecurityGroups,
+		"READALL_security_group_rule": listSecurityGroupRules,
+		"READALL_router":              listRouters,
+		"READALL_floatingip":          listFloatingIPs,
 	}
+	// paginatedTypes are the types of resources that are sorted and
+	// paged in the graph. Subnets, security groups and rules are
+	// converted from vertex properties after the query, paginated
+	// lists of them are forwarded to contrail-api.
+	paginatedTypes = []string{"port", "network", "router", "floatingip"}
+)
+
+var (
+	// ErrGremlinDisconnected indicates that gremlin server is not reachable
+	ErrGremlinDisconnected = errors.New("not connected to gremlin server")
+	// LivenessTimeout is the time the connection to gremlin server
+	// can stay lost before the app is not alive anymore
+	LivenessTimeout = 5 * time.Minute
+	// ContrailAPICheckInterval is the minimum time between
+	// two checks of contrail-api
+	ContrailAPICheckInterval = 10 * time.Second
 )
 
 type RequestOperation string
 
 const (
 	ListRequest = RequestOperation("READALL")
+	ReadRequest = RequestOperation("READ")
 )
 
+// NeutronError is an error returned to the neutron plugin. The plugin
+// raises the neutron exception named Exception with Params as arguments.
+type NeutronError struct {
+	Code      int
+	Exception string
+	Params    map[string]interface{}
+}
+
+func (e NeutronError) Error() string {
+	return fmt.Sprintf("%s %v", e.Exception, e.Params)
+}
+
+// MarshalJSON returns the error in the format of contrail-api errors
+// (eg: {"exception": "PortNotFound", "port_id": "..."})
+func (e NeutronError) MarshalJSON() ([]byte, error) {
+	data := map[string]interface{}{
+		"exception": e.Exception,
+	}
+	for k, v := range e.Params {
+		data[k] = v
+	}
+	return json.Marshal(data)
+}
+
+// newNotFoundError returns the error of a missing resource
+// (eg: PortNotFound with port_id)
+func newNotFoundError(exception string, idName string, id string) NeutronError {
+	return NeutronError{
+		Code:      http.StatusNotFound,
+		Exception: exception,
+		Params: map[string]interface{}{
+			idName: id,
+		},
+	}
+}
+
 // RequestContext the context of incoming requests
 type RequestContext struct {
 	Type      string           `json:"type"`
@@ -52,6 +114,18 @@ type RequestData struct {
 	ID      string         `json:"id"`
 	Fields  []string       `json:"fields"`
 	Filters RequestFilters `json:"filters"`
+	// Limit, Marker, SortKey and SortDir are the pagination
+	// and sorting parameters of list requests
+	Limit   int      `json:"limit"`
+	Marker  string   `json:"marker"`
+	SortKey []string `json:"sort_key"`
+	SortDir []string `json:"sort_dir"`
+}
+
+// paginated returns true when the results of a list
+// request must be sorted
+func (d RequestData) paginated() bool {
+	return d.Limit > 0 || d.Marker != "" || len(d.SortKey) > 0
 }
 
 type RequestFilters map[string][]interface{}
@@ -193,6 +267,23 @@ func (a *App) execute(query *gremlinQuery, bindings gremlin.Bind) ([]byte, error
 	return res, nil
 }
 
+// executeOne returns the first result of query, notFound
+// is returned when the query has no result
+func (a *App) executeOne(query *gremlinQuery, bindings gremlin.Bind, notFound error) ([]byte, error) {
+	res, err := a.execute(query, bindings)
+	if err != nil {
+		return []byte{}, err
+	}
+	var results []json.RawMessage
+	if err := json.Unmarshal(res, &results); err != nil {
+		return []byte{}, err
+	}
+	if len(results) == 0 {
+		return []byte{}, notFound
+	}
+	return results[0], nil
+}
+
 func (a *App) handler(w http.ResponseWriter, r *http.Request) {
 	if !a.backend.IsConnected() {
 		a.forward(w, r, r.Body)
@@ -219,8 +310,18 @@ func (a *App) handler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if we have an implementation for this request
 	handler, ok := a.methods[fmt.Sprintf("%s_%s", req.Context.Operation, req.Context.Type)]
+	if ok && req.Data.paginated() && !hasField(paginatedTypes, req.Context.Type) {
+		ok = false
+	}
 	if ok {
 		res, err := handler(req, a)
+		if neutronErr, ok := err.(NeutronError); ok {
+			log.Debugf("Handler returned %s", neutronErr)
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(neutronErr.Code)
+			json.NewEncoder(w).Encode(neutronErr)
+			return
+		}
 		if err != nil {
 			log.Errorf("Handler hit an error: %s", err)
 			w.WriteHeader(500)
@@ -236,6 +337,49 @@ func (a *App) handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// checkGremlin returns an error when requests
+// can't be handled with gremlin server
+func (a *App) checkGremlin() error {
+	if !a.backend.IsConnected() {
+		return ErrGremlinDisconnected
+	}
+	return nil
+}
+
+// checkContrailAPI returns an error when requests
+// can't be forwarded to contrail-api
+func (a *App) checkContrailAPI() error {
+	resp, err := a.contrailClient.Get(a.contrailAPIURL + "/")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("contrail-api returned %s", resp.Status)
+	}
+	return nil
+}
+
+// livenessChecks returns the checks of the connection to gremlin
+// server. The client reconnects by itself, the app is not alive
+// when the connection stays lost for more than LivenessTimeout.
+func (a *App) livenessChecks() []utils.HealthCheck {
+	return []utils.HealthCheck{
+		{Name: "gremlin", Check: utils.FailingFor(a.checkGremlin, LivenessTimeout)},
+	}
+}
+
+// readinessChecks returns the dependencies of the app. When
+// gremlin server is not reachable requests are forwarded to
+// contrail-api, so the gremlin check is optional. contrail-api
+// is checked at most once every ContrailAPICheckInterval.
+func (a *App) readinessChecks() []utils.HealthCheck {
+	return []utils.HealthCheck{
+		{Name: "contrail-api", Check: utils.Cached(a.checkContrailAPI, ContrailAPICheckInterval)},
+		{Name: "gremlin", Check: a.checkGremlin, Optional: true},
+	}
+}
+
 func (a *App) stop() {
 	a.backend.Stop()
 }
@@ -286,6 +430,8 @@ func run(gremlinURI string, contrailAPISrv string, gremlinGraphName string, impl
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/neutron/", app.handler)
+	mux.Handle("/healthz", utils.HealthHandler(app.livenessChecks()))
+	mux.Handle("/readyz", utils.HealthHandler(app.readinessChecks()))
 
 	srv := http.Server{
 		Addr:         ":8080",
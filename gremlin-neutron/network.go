@@ -28,15 +28,7 @@ func listNetworks(r Request, app *App) ([]byte, error) {
 	query.Add(`g.V().hasLabel('virtual_network')`)
 
 	if !r.Context.IsAdmin {
-		query.Add(`.where(values('id_perms').select('user_visible').is(true))`)
-		query.Add(`.where(
-			or(
-				__.out('parent').has(id, _tenant_id),
-				has('router_external', true),
-				has('is_shared', true)
-			)
-		)`)
-		bindings["_tenant_id"] = r.Context.TenantID
+		networkOwnerQuery(query, bindings, r.Context)
 	}
 
 	// Add filters to the query
@@ -58,7 +50,53 @@ func listNetworks(r Request, app *App) ([]byte, error) {
 			}
 		})
 
-	valuesQuery(query, r.Data.Fields, networkDefaultFields,
+	notFound := newNotFoundError("NetworkNotFound", "net_id", r.Data.Marker)
+	if err := paginationQuery(app, query, bindings, r, "virtual_network", notFound,
+		networkDefaultFields, networkValuesQuery, networkOwnerQuery); err != nil {
+		return []byte{}, err
+	}
+
+	networkValuesQuery(query, r.Data.Fields)
+
+	return app.execute(query, bindings)
+}
+
+func readNetwork(r Request, app *App) ([]byte, error) {
+	var (
+		query    = &gremlinQuery{}
+		bindings = gremlin.Bind{}
+		notFound = newNotFoundError("NetworkNotFound", "net_id", r.Data.ID)
+	)
+
+	if !readQuery(query, bindings, "virtual_network", r.Data.ID) {
+		return []byte{}, notFound
+	}
+
+	if !r.Context.IsAdmin {
+		networkOwnerQuery(query, bindings, r.Context)
+	}
+
+	networkValuesQuery(query, r.Data.Fields)
+
+	return app.executeOne(query, bindings, notFound)
+}
+
+// networkOwnerQuery keeps the networks of the tenant and
+// the external or shared networks
+func networkOwnerQuery(query *gremlinQuery, bindings gremlin.Bind, c RequestContext) {
+	query.Add(`.where(values('id_perms').select('user_visible').is(true))`)
+	query.Add(`.where(
+		or(
+			__.out('parent').has(id, _tenant_id),
+			has('router_external', true),
+			has('is_shared', true)
+		)
+	)`)
+	bindings["_tenant_id"] = c.TenantID
+}
+
+func networkValuesQuery(query *gremlinQuery, fields []string) {
+	valuesQuery(query, fields, networkDefaultFields,
 		func(query *gremlinQuery, field string) {
 			switch field {
 			case "tenant_id":
@@ -102,6 +140,4 @@ func listNetworks(r Request, app *App) ([]byte, error) {
 			)`)
 			}
 		})
-
-	return app.execute(query, bindings)
 }
@@ -24,6 +24,15 @@ func parseNetworks(resp *http.Response) (networks []neutron.Network) {
 	return networks
 }
 
+func parseNetwork(resp *http.Response) (network neutron.Network) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &network)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return network
+}
+
 func TestNetworkListUser(t *testing.T) {
 	resp := makeNetworkRequest(tenantID, false, RequestData{})
 	assert.Equal(t, 200, resp.StatusCode, "")
@@ -31,3 +40,54 @@ func TestNetworkListUser(t *testing.T) {
 	nets := parseNetworks(resp)
 	assert.Equal(t, 4, len(nets))
 }
+
+func TestNetworkListUserSortMarker(t *testing.T) {
+	data := RequestData{
+		Fields:  []string{"id", "router:external"},
+		SortKey: []string{"router:external"},
+		SortDir: []string{"desc"},
+	}
+	all := parseNetworks(makeNetworkRequest(tenantID, false, data))
+	assert.Equal(t, 4, len(all))
+	assert.True(t, all[0].RouterExternal)
+
+	// booleans of the marker are compared as booleans
+	data.Limit = 2
+	data.Marker = all[0].ID.String()
+	resp := makeNetworkRequest(tenantID, false, data)
+	assert.Equal(t, 200, resp.StatusCode, "")
+	assert.Equal(t, all[1:3], parseNetworks(resp))
+}
+
+func TestNetworkReadUser(t *testing.T) {
+	resp := makeRequest("network", ReadRequest, tenantID, false, RequestData{
+		ID: "e863c27f-ae81-4c0c-926d-28a95ef8b21f",
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	net := parseNetwork(resp)
+	assert.Equal(t, "e863c27f-ae81-4c0c-926d-28a95ef8b21f", net.ID.String())
+	assert.Equal(t, "aap_net", net.Name)
+	assert.Equal(t, tenantID, net.TenantID)
+}
+
+func TestNetworkReadUserOtherTenant(t *testing.T) {
+	resp := makeRequest("network", ReadRequest, tenantID, false, RequestData{
+		ID: "1e8ec672-8040-4a9c-a5f7-8c348138a864",
+	})
+	assert.Equal(t, 404, resp.StatusCode, "")
+
+	err := parseNeutronError(resp)
+	assert.Equal(t, "NetworkNotFound", err["exception"])
+	assert.Equal(t, "1e8ec672-8040-4a9c-a5f7-8c348138a864", err["net_id"])
+}
+
+func TestNetworkReadAdmin(t *testing.T) {
+	resp := makeRequest("network", ReadRequest, tenantID, true, RequestData{
+		ID: "1e8ec672-8040-4a9c-a5f7-8c348138a864",
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	net := parseNetwork(resp)
+	assert.Equal(t, "backend_net", net.Name)
+}
@@ -81,7 +81,39 @@ func listPorts(r Request, app *App) ([]byte, error) {
 			}
 		})
 
-	valuesQuery(query, r.Data.Fields, portDefaultFields,
+	notFound := newNotFoundError("PortNotFound", "port_id", r.Data.Marker)
+	if err := paginationQuery(app, query, bindings, r, "virtual_machine_interface", notFound,
+		portDefaultFields, portValuesQuery, projectOwnerQuery); err != nil {
+		return []byte{}, err
+	}
+
+	portValuesQuery(query, r.Data.Fields)
+
+	return app.execute(query, bindings)
+}
+
+func readPort(r Request, app *App) ([]byte, error) {
+	var (
+		query    = &gremlinQuery{}
+		bindings = gremlin.Bind{}
+		notFound = newNotFoundError("PortNotFound", "port_id", r.Data.ID)
+	)
+
+	if !readQuery(query, bindings, "virtual_machine_interface", r.Data.ID) {
+		return []byte{}, notFound
+	}
+
+	if !r.Context.IsAdmin {
+		projectOwnerQuery(query, bindings, r.Context)
+	}
+
+	portValuesQuery(query, r.Data.Fields)
+
+	return app.executeOne(query, bindings, notFound)
+}
+
+func portValuesQuery(query *gremlinQuery, fields []string) {
+	valuesQuery(query, fields, portDefaultFields,
 		func(query *gremlinQuery, field string) {
 			switch field {
 			case "tenant_id":
@@ -171,6 +203,4 @@ func listPorts(r Request, app *App) ([]byte, error) {
 				)`)
 			}
 		})
-
-	return app.execute(query, bindings)
 }
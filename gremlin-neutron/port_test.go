@@ -24,6 +24,15 @@ func parsePorts(resp *http.Response) (ports []neutron.Port) {
 	return ports
 }
 
+func parsePort(resp *http.Response) (port neutron.Port) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &port)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return port
+}
+
 func TestListUser(t *testing.T) {
 	resp := makePortRequest(tenantID, false, RequestData{})
 	assert.Equal(t, 200, resp.StatusCode, "")
@@ -149,3 +158,146 @@ func TestListUserFields(t *testing.T) {
 	assert.Equal(t, "", ports[0].Status)
 	assert.Equal(t, "", ports[0].DeviceID)
 }
+
+func TestListUserLimit(t *testing.T) {
+	resp := makePortRequest(tenantID, false, RequestData{
+		Limit: 2,
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+	ports := parsePorts(resp)
+	assert.Equal(t, 2, len(ports))
+	assert.True(t, ports[0].ID.String() < ports[1].ID.String())
+}
+
+func TestListUserMarker(t *testing.T) {
+	resp := makePortRequest(tenantID, false, RequestData{
+		Limit: 2,
+	})
+	first := parsePorts(resp)
+
+	resp = makePortRequest(tenantID, false, RequestData{
+		Limit:  2,
+		Marker: first[1].ID.String(),
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+	ports := parsePorts(resp)
+	assert.Equal(t, 2, len(ports))
+	assert.True(t, first[1].ID.String() < ports[0].ID.String())
+
+	resp = makePortRequest(tenantID, false, RequestData{
+		Marker: "a5bd9a6d-5d3a-4c0b-9d79-1b0c5e5f3c11",
+	})
+	assert.Equal(t, 404, resp.StatusCode, "")
+	err := parseNeutronError(resp)
+	assert.Equal(t, "PortNotFound", err["exception"])
+	assert.Equal(t, "a5bd9a6d-5d3a-4c0b-9d79-1b0c5e5f3c11", err["port_id"])
+
+	// the marker is a port of another tenant
+	resp = makePortRequest(tenantID, false, RequestData{
+		Marker: "599457f3-102e-4387-b59f-63a1ce1192eb",
+	})
+	assert.Equal(t, 404, resp.StatusCode, "")
+	err = parseNeutronError(resp)
+	assert.Equal(t, "PortNotFound", err["exception"])
+
+	resp = makePortRequest(tenantID, true, RequestData{
+		Marker: "599457f3-102e-4387-b59f-63a1ce1192eb",
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+}
+
+func TestListUserSortMarker(t *testing.T) {
+	data := RequestData{
+		Fields:  []string{"id", "name"},
+		SortKey: []string{"name"},
+		SortDir: []string{"desc"},
+	}
+	all := parsePorts(makePortRequest(tenantID, false, data))
+
+	data.Limit = 2
+	data.Marker = all[1].ID.String()
+	resp := makePortRequest(tenantID, false, data)
+	assert.Equal(t, 200, resp.StatusCode, "")
+	assert.Equal(t, all[2:4], parsePorts(resp))
+}
+
+func TestListUserSort(t *testing.T) {
+	resp := makePortRequest(tenantID, false, RequestData{
+		Fields:  []string{"id"},
+		SortKey: []string{"name"},
+		SortDir: []string{"desc"},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+	ports := parsePorts(resp)
+	assert.Equal(t, 6, len(ports))
+	// the sort key is not returned when it is not requested
+	assert.Equal(t, "", ports[0].Name)
+
+	resp = makePortRequest(tenantID, false, RequestData{
+		Fields:  []string{"name"},
+		SortKey: []string{"name"},
+		SortDir: []string{"desc"},
+	})
+	ports = parsePorts(resp)
+	for i := 1; i < len(ports); i++ {
+		assert.True(t, ports[i-1].Name >= ports[i].Name)
+	}
+}
+
+func TestReadUser(t *testing.T) {
+	resp := makeRequest("port", ReadRequest, tenantID, false, RequestData{
+		ID: "ec12373a-7452-4a51-af9c-5cd9cfb48513",
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	port := parsePort(resp)
+	assert.Equal(t, "ec12373a-7452-4a51-af9c-5cd9cfb48513", port.ID.String())
+	assert.Equal(t, "aap_vm1_port", port.Name)
+	assert.Equal(t, "15.15.15.15", port.AAPs[0].IP)
+}
+
+func TestReadUserFields(t *testing.T) {
+	resp := makeRequest("port", ReadRequest, tenantID, false, RequestData{
+		ID:     "ec12373a-7452-4a51-af9c-5cd9cfb48513",
+		Fields: []string{"id", "name"},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	port := parsePort(resp)
+	assert.Equal(t, "aap_vm1_port", port.Name)
+	assert.Equal(t, "", port.Status)
+}
+
+func TestReadUserOtherTenant(t *testing.T) {
+	resp := makeRequest("port", ReadRequest, tenantID, false, RequestData{
+		ID: "28a5ea5d-c184-4b21-acf8-00ba49e118e0",
+	})
+	assert.Equal(t, 404, resp.StatusCode, "")
+
+	err := parseNeutronError(resp)
+	assert.Equal(t, "PortNotFound", err["exception"])
+	assert.Equal(t, "28a5ea5d-c184-4b21-acf8-00ba49e118e0", err["port_id"])
+}
+
+func TestReadAdmin(t *testing.T) {
+	resp := makeRequest("port", ReadRequest, tenantID, true, RequestData{
+		ID: "28a5ea5d-c184-4b21-acf8-00ba49e118e0",
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	port := parsePort(resp)
+	assert.Equal(t, "28a5ea5d-c184-4b21-acf8-00ba49e118e0", port.ID.String())
+}
+
+func TestReadNotFound(t *testing.T) {
+	for _, id := range []string{"a5bd9a6d-5d3a-4c0b-9d79-1b0c5e5f3c11", "foo"} {
+		resp := makeRequest("port", ReadRequest, tenantID, true, RequestData{
+			ID: id,
+		})
+		assert.Equal(t, 404, resp.StatusCode, "")
+
+		err := parseNeutronError(resp)
+		assert.Equal(t, "PortNotFound", err["exception"])
+		assert.Equal(t, id, err["port_id"])
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/eonpatapon/gremlin"
+)
+
+var routerDefaultFields = []string{
+	"id",
+	"tenant_id",
+	"name",
+	"description",
+	"admin_state_up",
+	"status",
+	"external_gateway_info",
+	"created_at",
+	"updated_at",
+}
+
+func listRouters(r Request, app *App) ([]byte, error) {
+	var (
+		query    = &gremlinQuery{}
+		bindings = gremlin.Bind{}
+	)
+
+	if r.Context.IsAdmin {
+		query.Add(`g.V().hasLabel('logical_router')`)
+	} else {
+		query.Add(`g.V(_tenant_id).in('parent').hasLabel('logical_router')`)
+		query.Add(`.where(values('id_perms').select('user_visible').is(true))`)
+		bindings["_tenant_id"] = r.Context.TenantID
+	}
+
+	filterQuery(query, bindings, r.Data.Filters,
+		func(query *gremlinQuery, key string, valuesQuery string) {
+			switch key {
+			case "tenant_id":
+				// Add this filter only in admin context, because in user context
+				// the collection is already filtered above.
+				if r.Context.IsAdmin {
+					query.Addf(`.where(__.out('parent').has(id, %s))`, valuesQuery)
+				}
+			default:
+				log.Warningf("No implementation for filter %s", key)
+			}
+		})
+
+	notFound := newNotFoundError("RouterNotFound", "router_id", r.Data.Marker)
+	if err := paginationQuery(app, query, bindings, r, "logical_router", notFound,
+		routerDefaultFields, routerValuesQuery, projectOwnerQuery); err != nil {
+		return []byte{}, err
+	}
+
+	routerValuesQuery(query, r.Data.Fields)
+
+	res, err := app.execute(query, bindings)
+	if err != nil {
+		return []byte{}, err
+	}
+	return unfoldFields(res, "external_gateway_info")
+}
+
+func routerValuesQuery(query *gremlinQuery, fields []string) {
+	valuesQuery(query, fields, routerDefaultFields,
+		func(query *gremlinQuery, field string) {
+			switch field {
+			case "tenant_id":
+				query.Add(`.by(__.out('parent').id().map{ it.get().toString().replace('-', '') })`)
+			case "status":
+				query.Add(`.by(constant('ACTIVE'))`)
+			case "external_gateway_info":
+				// The gateway is the ref to the external network, SNAT
+				// is done by a service instance. The gateway ips are the
+				// ips of the service instance in the external network.
+				query.Add(`.by(
+					__.where(__.out('ref').hasLabel('virtual_network'))
+						.project('network_id', 'enable_snat', 'external_fixed_ips')
+							.by(__.out('ref').hasLabel('virtual_network').id())
+							.by(
+								choose(
+									__.out('ref').hasLabel('service_instance'),
+									constant(true),
+									constant(false)
+								)
+							)
+							.by(
+								__.as('router').out('ref').hasLabel('virtual_network').as('gateway')
+									.select('router').out('ref').hasLabel('service_instance')
+									.in('ref').hasLabel('virtual_machine')
+									.in('ref').hasLabel('virtual_machine_interface')
+									.where(
+										__.out('ref').hasLabel('virtual_network')
+											.where(eq('gateway'))
+									)
+									.in('ref').hasLabel('instance_ip').dedup()
+									.project('subnet_id', 'ip_address')
+										.by(coalesce(values('subnet_uuid'), constant('')))
+										.by('instance_ip_address')
+									.fold()
+							)
+						.fold()
+				)`)
+			}
+		})
+}
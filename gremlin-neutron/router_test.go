@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type externalFixedIP struct {
+	SubnetID  string `json:"subnet_id"`
+	IPAddress string `json:"ip_address"`
+}
+
+type externalGatewayInfo struct {
+	NetworkID        uuid.UUID         `json:"network_id"`
+	EnableSNAT       bool              `json:"enable_snat"`
+	ExternalFixedIPs []externalFixedIP `json:"external_fixed_ips"`
+}
+
+type router struct {
+	ID                  uuid.UUID            `json:"id"`
+	TenantID            string               `json:"tenant_id"`
+	Name                string               `json:"name"`
+	ExternalGatewayInfo *externalGatewayInfo `json:"external_gateway_info"`
+}
+
+func makeRouterRequest(tenantID string, isAdmin bool, data RequestData) *http.Response {
+	return makeRequest("router", ListRequest, tenantID, isAdmin, data)
+}
+
+func parseRouters(resp *http.Response) (routers []router) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &routers)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return routers
+}
+
+func TestRouterListUser(t *testing.T) {
+	resp := makeRouterRequest(tenantID, false, RequestData{})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	routers := parseRouters(resp)
+	assert.Equal(t, 1, len(routers))
+	assert.Equal(t, "3647b23e-f261-45ec-80fe-be21fc868df6", routers[0].ID.String())
+	assert.Equal(t, "aap_router", routers[0].Name)
+	assert.Equal(t, tenantID, routers[0].TenantID)
+	assert.Nil(t, routers[0].ExternalGatewayInfo)
+}
+
+func TestRouterListAdmin(t *testing.T) {
+	resp := makeRouterRequest(tenantID, true, RequestData{})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	routers := parseRouters(resp)
+	assert.Equal(t, 11, len(routers))
+}
+
+func TestRouterListAdminGateway(t *testing.T) {
+	resp := makeRouterRequest(tenantID, true, RequestData{
+		Filters: RequestFilters{
+			"id": []interface{}{"5e19c4c8-bb46-45dd-a5e3-7430b0938aa3"},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	routers := parseRouters(resp)
+	assert.Equal(t, 1, len(routers))
+	assert.Equal(t, "gateway_aap", routers[0].Name)
+	assert.Equal(t, "50360408-700d-4af9-a8ca-14307ccc1834", routers[0].ExternalGatewayInfo.NetworkID.String())
+	assert.True(t, routers[0].ExternalGatewayInfo.EnableSNAT)
+	// both SNAT instances share the gateway ip
+	assert.Equal(t, []externalFixedIP{
+		{SubnetID: "2dd73a88-fc85-4bae-b1f4-48fa7c520437", IPAddress: "84.39.62.124"},
+	}, routers[0].ExternalGatewayInfo.ExternalFixedIPs)
+}
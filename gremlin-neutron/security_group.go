@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/eonpatapon/gremlin"
+	"github.com/satori/go.uuid"
+
+	"github.com/eonpatapon/contrail-gremlin/neutron"
+)
+
+var securityGroupDefaultFields = []string{
+	"id",
+	"tenant_id",
+	"name",
+	"description",
+	"security_group_rules",
+	"created_at",
+	"updated_at",
+}
+
+var securityGroupRuleDefaultFields = []string{
+	"id",
+	"tenant_id",
+	"security_group_id",
+	"direction",
+	"ethertype",
+	"protocol",
+	"port_range_min",
+	"port_range_max",
+	"remote_group_id",
+	"remote_ip_prefix",
+	"created_at",
+	"updated_at",
+}
+
+// securityGroupQueryFields are the values returned by the
+// security groups query
+var securityGroupQueryFields = []string{
+	"id",
+	"tenant_id",
+	"name",
+	"description",
+	"created_at",
+	"updated_at",
+	"security_group_entries",
+}
+
+type securityGroupResult struct {
+	ID          uuid.UUID    `json:"id"`
+	TenantID    string       `json:"tenant_id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   string       `json:"updated_at"`
+	Entries     []policyRule `json:"security_group_entries"`
+}
+
+// policyRule is a rule of the security_group_entries
+// property of a security_group
+type policyRule struct {
+	RuleUUID     string          `json:"rule_uuid"`
+	Protocol     string          `json:"protocol"`
+	Ethertype    string          `json:"ethertype"`
+	SrcAddresses []policyAddress `json:"src_addresses"`
+	DstAddresses []policyAddress `json:"dst_addresses"`
+	DstPorts     []struct {
+		StartPort *int `json:"start_port"`
+		EndPort   *int `json:"end_port"`
+	} `json:"dst_ports"`
+	Created      string `json:"created"`
+	LastModified string `json:"last_modified"`
+}
+
+type policyAddress struct {
+	// SecurityGroup is local, any or the fq_name of a
+	// security group (eg: default-domain:demo:default)
+	SecurityGroup *string `json:"security_group"`
+	Subnet        *struct {
+		IPPrefix    string `json:"ip_prefix"`
+		IPPrefixLen int    `json:"ip_prefix_len"`
+	} `json:"subnet"`
+}
+
+// remoteGroup returns the fq_name of the security group of a, if any
+func (a policyAddress) remoteGroup() (string, bool) {
+	if a.SecurityGroup == nil {
+		return "", false
+	}
+	switch *a.SecurityGroup {
+	case "local", "any", "":
+		return "", false
+	}
+	return *a.SecurityGroup, true
+}
+
+func listSecurityGroups(r Request, app *App) ([]byte, error) {
+	groups, err := getSecurityGroups(r, app, r.Data.Filters)
+	if err != nil {
+		return []byte{}, err
+	}
+	fields := validateFields(r.Data.Fields, securityGroupDefaultFields)
+	res := make([]map[string]json.RawMessage, len(groups))
+	for i, group := range groups {
+		if res[i], err = selectFields(group, fields); err != nil {
+			return []byte{}, err
+		}
+	}
+	return json.Marshal(res)
+}
+
+func listSecurityGroupRules(r Request, app *App) ([]byte, error) {
+	var (
+		groupFilters = make(RequestFilters, 0)
+		ruleFilters  = make(RequestFilters, 0)
+	)
+	// Filters of the security group are done in the query
+	for key, values := range r.Data.Filters {
+		switch key {
+		case "security_group_id":
+			groupFilters["id"] = values
+		case "tenant_id":
+			groupFilters[key] = values
+		default:
+			ruleFilters[key] = values
+		}
+	}
+	groups, err := getSecurityGroups(r, app, groupFilters)
+	if err != nil {
+		return []byte{}, err
+	}
+	fields := validateFields(r.Data.Fields, securityGroupRuleDefaultFields)
+	res := make([]map[string]json.RawMessage, 0)
+	for _, group := range groups {
+		for _, rule := range group.Rules {
+			if !matchFilters(rule, ruleFilters) {
+				continue
+			}
+			values, err := selectFields(rule, fields)
+			if err != nil {
+				return []byte{}, err
+			}
+			res = append(res, values)
+		}
+	}
+	return json.Marshal(res)
+}
+
+func getSecurityGroups(r Request, app *App, filters RequestFilters) ([]neutron.SecurityGroup, error) {
+	var (
+		query    = &gremlinQuery{}
+		bindings = gremlin.Bind{}
+	)
+
+	if r.Context.IsAdmin {
+		query.Add(`g.V().hasLabel('security_group')`)
+	} else {
+		query.Add(`g.V(_tenant_id).in('parent').hasLabel('security_group')`)
+		query.Add(`.where(values('id_perms').select('user_visible').is(true))`)
+		bindings["_tenant_id"] = r.Context.TenantID
+	}
+	query.Add(`.not(has('fq_name', ['default-domain', 'default-project', '__no_rule__']))`)
+
+	filterQuery(query, bindings, filters,
+		func(query *gremlinQuery, key string, valuesQuery string) {
+			switch key {
+			case "tenant_id":
+				// Add this filter only in admin context, because in user context
+				// the collection is already filtered above.
+				if r.Context.IsAdmin {
+					query.Addf(`.where(__.out('parent').has(id, %s))`, valuesQuery)
+				}
+			default:
+				log.Warningf("No implementation for filter %s", key)
+			}
+		})
+
+	valuesQuery(query, securityGroupQueryFields, securityGroupQueryFields,
+		func(query *gremlinQuery, field string) {
+			switch field {
+			case "tenant_id":
+				query.Add(`.by(__.out('parent').id().map{ it.get().toString().replace('-', '') })`)
+			case "security_group_entries":
+				query.Add(`.by(
+					coalesce(
+						values('security_group_entries').select('policy_rule'),
+						constant([])
+					)
+				)`)
+			}
+		})
+
+	res, err := app.execute(query, bindings)
+	if err != nil {
+		return nil, err
+	}
+	var results []securityGroupResult
+	if err := json.Unmarshal(res, &results); err != nil {
+		return nil, err
+	}
+	remoteGroups, err := app.securityGroupIDs(results)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]neutron.SecurityGroup, len(results))
+	for i, result := range results {
+		groups[i] = result.toNeutron(remoteGroups)
+	}
+	return groups, nil
+}
+
+// securityGroupIDs returns the ids of the remote security
+// groups of the rules indexed by fq_name
+func (a *App) securityGroupIDs(results []securityGroupResult) (map[string]uuid.UUID, error) {
+	var (
+		ids      = make(map[string]uuid.UUID, 0)
+		fqNames  = make([][]string, 0)
+		query    = &gremlinQuery{}
+		bindings = gremlin.Bind{}
+	)
+	for _, result := range results {
+		for _, rule := range result.Entries {
+			for _, addresses := range [][]policyAddress{rule.SrcAddresses, rule.DstAddresses} {
+				for _, address := range addresses {
+					if fqName, ok := address.remoteGroup(); ok {
+						if _, ok := ids[fqName]; !ok {
+							ids[fqName] = uuid.Nil
+							fqNames = append(fqNames, strings.Split(fqName, ":"))
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(fqNames) == 0 {
+		return ids, nil
+	}
+
+	query.Add(`g.V().hasLabel('security_group').has('fq_name', within(_fq_names))`)
+	query.Add(`.project('id', 'fq_name').by(id).by(values('fq_name'))`)
+	bindings["_fq_names"] = fqNames
+
+	res, err := a.execute(query, bindings)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		ID     uuid.UUID `json:"id"`
+		FQName []string  `json:"fq_name"`
+	}
+	if err := json.Unmarshal(res, &groups); err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		ids[strings.Join(group.FQName, ":")] = group.ID
+	}
+	return ids, nil
+}
+
+func (s securityGroupResult) toNeutron(remoteGroups map[string]uuid.UUID) neutron.SecurityGroup {
+	group := neutron.SecurityGroup{
+		ID:          s.ID,
+		TenantID:    s.TenantID,
+		Name:        s.Name,
+		Description: s.Description,
+		Rules:       make([]neutron.SecurityGroupRule, 0, len(s.Entries)),
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   s.UpdatedAt,
+	}
+	for _, entry := range s.Entries {
+		rule, err := entry.toNeutron(remoteGroups)
+		if err != nil {
+			log.Warningf("Invalid rule %s of security group %s: %s", entry.RuleUUID, s.ID, err)
+			continue
+		}
+		rule.TenantID = s.TenantID
+		rule.SecurityGroupID = s.ID
+		group.Rules = append(group.Rules, rule)
+	}
+	return group
+}
+
+// toNeutron converts a contrail rule to a neutron rule. The local
+// security group is the source of egress rules and the destination
+// of ingress rules, the other side is the remote group or prefix.
+func (p policyRule) toNeutron(remoteGroups map[string]uuid.UUID) (neutron.SecurityGroupRule, error) {
+	rule := neutron.SecurityGroupRule{
+		Ethertype: p.Ethertype,
+		CreatedAt: p.Created,
+		UpdatedAt: p.LastModified,
+	}
+	id, err := uuid.FromString(p.RuleUUID)
+	if err != nil {
+		return rule, err
+	}
+	rule.ID = id
+	if len(p.SrcAddresses) == 0 || len(p.DstAddresses) == 0 {
+		return rule, fmt.Errorf("missing rule addresses")
+	}
+
+	var remote policyAddress
+	if src := p.SrcAddresses[0]; src.SecurityGroup != nil && *src.SecurityGroup == "local" {
+		rule.Direction = "egress"
+		remote = p.DstAddresses[0]
+	} else {
+		rule.Direction = "ingress"
+		remote = src
+	}
+	if fqName, ok := remote.remoteGroup(); ok {
+		if id, ok := remoteGroups[fqName]; ok && id != uuid.Nil {
+			rule.RemoteGroupID = &id
+		}
+	}
+	if remote.Subnet != nil {
+		prefix := fmt.Sprintf("%s/%d", remote.Subnet.IPPrefix, remote.Subnet.IPPrefixLen)
+		rule.RemoteIPPrefix = &prefix
+	}
+
+	if p.Protocol != "any" && p.Protocol != "" {
+		protocol := p.Protocol
+		rule.Protocol = &protocol
+	}
+	// the whole port range is the same as no port range
+	if len(p.DstPorts) > 0 {
+		ports := p.DstPorts[0]
+		if ports.StartPort != nil && ports.EndPort != nil && !(*ports.StartPort == 0 && *ports.EndPort == 65535) {
+			rule.PortRangeMin = ports.StartPort
+			rule.PortRangeMax = ports.EndPort
+		}
+	}
+	return rule, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/eonpatapon/contrail-gremlin/neutron"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeSecurityGroupRequest(tenantID string, isAdmin bool, data RequestData) *http.Response {
+	return makeRequest("security_group", ListRequest, tenantID, isAdmin, data)
+}
+
+func makeSecurityGroupRuleRequest(tenantID string, isAdmin bool, data RequestData) *http.Response {
+	return makeRequest("security_group_rule", ListRequest, tenantID, isAdmin, data)
+}
+
+func parseSecurityGroups(resp *http.Response) (groups []neutron.SecurityGroup) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &groups)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return groups
+}
+
+func parseSecurityGroupRules(resp *http.Response) (rules []neutron.SecurityGroupRule) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &rules)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return rules
+}
+
+func TestSecurityGroupListUser(t *testing.T) {
+	resp := makeSecurityGroupRequest(tenantID, false, RequestData{})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	groups := parseSecurityGroups(resp)
+	assert.Equal(t, 3, len(groups))
+}
+
+func TestSecurityGroupListUserFilterName(t *testing.T) {
+	resp := makeSecurityGroupRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"name": []interface{}{"default"},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	groups := parseSecurityGroups(resp)
+	assert.Equal(t, 1, len(groups))
+	assert.Equal(t, "25f855ba-466b-4677-bc0f-0a0ccea478a4", groups[0].ID.String())
+	assert.Equal(t, tenantID, groups[0].TenantID)
+
+	remoteGroups := 0
+	for _, rule := range groups[0].Rules {
+		if rule.RemoteGroupID != nil {
+			assert.Equal(t, "25f855ba-466b-4677-bc0f-0a0ccea478a4", rule.RemoteGroupID.String())
+			assert.Equal(t, "ingress", rule.Direction)
+			remoteGroups++
+		}
+	}
+	assert.Equal(t, 2, remoteGroups)
+}
+
+func TestSecurityGroupListAdminNoRule(t *testing.T) {
+	resp := makeSecurityGroupRequest(tenantID, true, RequestData{
+		Filters: RequestFilters{
+			"name": []interface{}{"__no_rule__"},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	groups := parseSecurityGroups(resp)
+	assert.Equal(t, 0, len(groups))
+}
+
+func TestSecurityGroupRuleListUser(t *testing.T) {
+	resp := makeSecurityGroupRuleRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"security_group_id": []interface{}{"d5549836-03a8-47e8-b44e-9beaa3237d05"},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	rules := parseSecurityGroupRules(resp)
+	assert.Equal(t, 4, len(rules))
+}
+
+func TestSecurityGroupRuleListUserFilters(t *testing.T) {
+	resp := makeSecurityGroupRuleRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"security_group_id": []interface{}{"d5549836-03a8-47e8-b44e-9beaa3237d05"},
+			"protocol":          []interface{}{"tcp"},
+			"direction":         []interface{}{"ingress"},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	rules := parseSecurityGroupRules(resp)
+	assert.Equal(t, 1, len(rules))
+	rule := rules[0]
+	assert.Equal(t, "2d0f8206-58cf-4e87-816b-4c4222b51e01", rule.ID.String())
+	assert.Equal(t, "d5549836-03a8-47e8-b44e-9beaa3237d05", rule.SecurityGroupID.String())
+	assert.Equal(t, "IPv4", rule.Ethertype)
+	assert.Equal(t, 22, *rule.PortRangeMin)
+	assert.Equal(t, 22, *rule.PortRangeMax)
+	assert.Equal(t, "0.0.0.0/0", *rule.RemoteIPPrefix)
+	assert.Nil(t, rule.RemoteGroupID)
+}
+
+func TestPolicyRuleToNeutron(t *testing.T) {
+	var p policyRule
+	json.Unmarshal([]byte(`{
+		"rule_uuid": "8e05e622-759b-4046-96de-f4e81578c3ce",
+		"protocol": "any",
+		"ethertype": "IPv6",
+		"src_addresses": [{"security_group": "local"}],
+		"dst_addresses": [{"security_group": "default-domain:demo:default"}],
+		"dst_ports": [{"start_port": 0, "end_port": 65535}]
+	}`), &p)
+	groupID, _ := uuid.NewV4()
+
+	rule, err := p.toNeutron(map[string]uuid.UUID{"default-domain:demo:default": groupID})
+	assert.Nil(t, err)
+	assert.Equal(t, "egress", rule.Direction)
+	assert.Equal(t, "IPv6", rule.Ethertype)
+	assert.Equal(t, groupID, *rule.RemoteGroupID)
+	assert.Nil(t, rule.RemoteIPPrefix)
+	assert.Nil(t, rule.Protocol)
+	assert.Nil(t, rule.PortRangeMin)
+	assert.Nil(t, rule.PortRangeMax)
+
+	p.SrcAddresses = nil
+	_, err = p.toNeutron(map[string]uuid.UUID{})
+	assert.NotNil(t, err)
+}
+
+func TestMatchFilters(t *testing.T) {
+	protocol := "tcp"
+	port := 22
+	rule := neutron.SecurityGroupRule{
+		Direction:    "ingress",
+		Protocol:     &protocol,
+		PortRangeMin: &port,
+	}
+	assert.True(t, matchFilters(rule, RequestFilters{}))
+	assert.True(t, matchFilters(rule, RequestFilters{
+		"direction":      []interface{}{"egress", "ingress"},
+		"protocol":       []interface{}{"tcp"},
+		"port_range_min": []interface{}{float64(22)},
+	}))
+	assert.False(t, matchFilters(rule, RequestFilters{
+		"direction": []interface{}{"egress"},
+	}))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+
+	"github.com/eonpatapon/gremlin"
+	"github.com/satori/go.uuid"
+
+	"github.com/eonpatapon/contrail-gremlin/neutron"
+)
+
+var subnetDefaultFields = []string{
+	"id",
+	"tenant_id",
+	"network_id",
+	"name",
+	"cidr",
+	"gateway_ip",
+	"allocation_pools",
+	"dns_nameservers",
+	"host_routes",
+	"enable_dhcp",
+	"ip_version",
+	"created_at",
+	"updated_at",
+}
+
+// ipamSubnet is a subnet of the ipam_subnets property of
+// a virtual_network -> network_ipam ref
+type ipamSubnet struct {
+	Subnet struct {
+		IPPrefix    string `json:"ip_prefix"`
+		IPPrefixLen int    `json:"ip_prefix_len"`
+	} `json:"subnet"`
+	SubnetUUID      string                   `json:"subnet_uuid"`
+	SubnetName      string                   `json:"subnet_name"`
+	DefaultGateway  string                   `json:"default_gateway"`
+	EnableDHCP      *bool                    `json:"enable_dhcp"`
+	AllocationPools []neutron.AllocationPool `json:"allocation_pools"`
+	DNSNameservers  []string                 `json:"dns_nameservers"`
+	HostRoutes      *struct {
+		Route []struct {
+			Prefix  string `json:"prefix"`
+			NextHop string `json:"next_hop"`
+		} `json:"route"`
+	} `json:"host_routes"`
+	Created      string `json:"created"`
+	LastModified string `json:"last_modified"`
+}
+
+// networkSubnet is a result of the subnets query
+type networkSubnet struct {
+	Subnet    ipamSubnet `json:"subnet"`
+	NetworkID uuid.UUID  `json:"network_id"`
+	TenantID  string     `json:"tenant_id"`
+}
+
+func listSubnets(r Request, app *App) ([]byte, error) {
+	subnets, err := getSubnets(r, app, r.Data.Filters)
+	if err != nil {
+		return []byte{}, err
+	}
+	fields := validateFields(r.Data.Fields, subnetDefaultFields)
+	res := make([]map[string]json.RawMessage, len(subnets))
+	for i, subnet := range subnets {
+		if res[i], err = selectFields(subnet, fields); err != nil {
+			return []byte{}, err
+		}
+	}
+	return json.Marshal(res)
+}
+
+func readSubnet(r Request, app *App) ([]byte, error) {
+	notFound := newNotFoundError("SubnetNotFound", "subnet_id", r.Data.ID)
+	if _, err := uuid.FromString(r.Data.ID); err != nil {
+		return []byte{}, notFound
+	}
+	subnets, err := getSubnets(r, app, RequestFilters{
+		"id": []interface{}{r.Data.ID},
+	})
+	if err != nil {
+		return []byte{}, err
+	}
+	if len(subnets) == 0 {
+		return []byte{}, notFound
+	}
+	res, err := selectFields(subnets[0], validateFields(r.Data.Fields, subnetDefaultFields))
+	if err != nil {
+		return []byte{}, err
+	}
+	return json.Marshal(res)
+}
+
+// getSubnets returns the subnets matching filters. Network and subnet
+// id and name filters are done in the query, other filters on the
+// neutron subnets.
+func getSubnets(r Request, app *App, filters RequestFilters) ([]neutron.Subnet, error) {
+	var (
+		query        = &gremlinQuery{}
+		subnetQuery  = &gremlinQuery{}
+		bindings     = gremlin.Bind{}
+		localFilters = make(RequestFilters, 0)
+	)
+
+	query.Add(`g.V().hasLabel('virtual_network')`)
+	query.Add(`.not(has('_missing')).not(has('deleted', neq(0)))`)
+
+	if !r.Context.IsAdmin {
+		networkOwnerQuery(query, bindings, r.Context)
+	}
+
+	for key, values := range filters {
+		key, valuesQuery := filterQueryValues(key, values, bindings)
+		switch key {
+		case "tenant_id":
+			// In user context the collection also has the shared
+			// and external networks of other tenants. Tenant ids
+			// are sent without dashes.
+			query.Addf(`.where(
+				__.out('parent').id().map{ it.get().toString().replace('-', '') }.is(%s)
+			)`, valuesQuery)
+		case "network_id":
+			query.Addf(`.has(id, %s)`, valuesQuery)
+		case "id":
+			subnetQuery.Addf(`.where(select('subnet_uuid').is(%s))`, valuesQuery)
+		case "name":
+			subnetQuery.Addf(`.where(select('subnet_name').is(%s))`, valuesQuery)
+		case "cidr":
+			localFilters[key] = normalizeCIDRs(values)
+		case "ip_version", "enable_dhcp", "gateway_ip":
+			localFilters[key] = values
+		default:
+			log.Warningf("No implementation for filter %s", key)
+		}
+	}
+
+	query.Add(`.as('net')
+		.outE('ref').where(__.inV().hasLabel('network_ipam'))
+		.values('ipam_subnets').unfold()`)
+	query.Add(subnetQuery.String())
+	query.Add(`.project('subnet', 'network_id', 'tenant_id')
+		.by()
+		.by(select('net').id())
+		.by(
+			coalesce(
+				select('net').out('parent').id().map{ it.get().toString().replace('-', '') },
+				constant('')
+			)
+		)`)
+
+	res, err := app.execute(query, bindings)
+	if err != nil {
+		return nil, err
+	}
+	var results []networkSubnet
+	if err := json.Unmarshal(res, &results); err != nil {
+		return nil, err
+	}
+	subnets := make([]neutron.Subnet, 0, len(results))
+	for _, result := range results {
+		subnet, err := result.Subnet.toNeutron(result.NetworkID, result.TenantID)
+		if err != nil {
+			log.Warningf("Invalid subnet %s: %s", result.Subnet.SubnetUUID, err)
+			continue
+		}
+		if matchFilters(subnet, localFilters) {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets, nil
+}
+
+// toNeutron converts a contrail subnet to a neutron subnet. When the
+// subnet has no allocation pools the whole subnet is used except the
+// network, broadcast and gateway addresses.
+func (s ipamSubnet) toNeutron(networkID uuid.UUID, tenantID string) (neutron.Subnet, error) {
+	subnet := neutron.Subnet{
+		TenantID:        tenantID,
+		NetworkID:       networkID,
+		Name:            s.SubnetName,
+		EnableDHCP:      s.EnableDHCP == nil || *s.EnableDHCP,
+		AllocationPools: s.AllocationPools,
+		DNSNameservers:  s.DNSNameservers,
+		HostRoutes:      []neutron.HostRoute{},
+		CreatedAt:       s.Created,
+		UpdatedAt:       s.LastModified,
+	}
+	id, err := uuid.FromString(s.SubnetUUID)
+	if err != nil {
+		return subnet, err
+	}
+	subnet.ID = id
+	ip, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", s.Subnet.IPPrefix, s.Subnet.IPPrefixLen))
+	if err != nil {
+		return subnet, err
+	}
+	subnet.CIDR = ipNet.String()
+	if ip.To4() != nil {
+		subnet.IPVersion = 4
+	} else {
+		subnet.IPVersion = 6
+	}
+	if gateway := net.ParseIP(s.DefaultGateway); gateway != nil && !gateway.IsUnspecified() {
+		gatewayIP := gateway.String()
+		subnet.GatewayIP = &gatewayIP
+	}
+	if len(subnet.AllocationPools) == 0 {
+		subnet.AllocationPools = defaultAllocationPools(ipNet, net.ParseIP(s.DefaultGateway), subnet.IPVersion)
+	}
+	if subnet.DNSNameservers == nil {
+		subnet.DNSNameservers = []string{}
+	}
+	if s.HostRoutes != nil {
+		for _, route := range s.HostRoutes.Route {
+			subnet.HostRoutes = append(subnet.HostRoutes, neutron.HostRoute{
+				Destination: route.Prefix,
+				NextHop:     route.NextHop,
+			})
+		}
+	}
+	return subnet, nil
+}
+
+func defaultAllocationPools(ipNet *net.IPNet, gateway net.IP, ipVersion int) []neutron.AllocationPool {
+	size := net.IPv6len
+	if ipVersion == 4 {
+		size = net.IPv4len
+	}
+	network := ipToInt(ipNet.IP)
+	ones, bits := ipNet.Mask.Size()
+	hostBits := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	last := new(big.Int).Add(network, hostBits)
+	last.Sub(last, big.NewInt(1))
+	// the broadcast address is reserved in IPv4
+	if ipVersion == 4 {
+		last.Sub(last, big.NewInt(1))
+	}
+	first := new(big.Int).Add(network, big.NewInt(1))
+	if gateway != nil {
+		if ipVersion == 4 {
+			gateway = gateway.To4()
+		}
+		gw := ipToInt(gateway)
+		if gw.Cmp(first) == 0 {
+			first.Add(first, big.NewInt(1))
+		}
+		if gw.Cmp(last) == 0 {
+			last.Sub(last, big.NewInt(1))
+		}
+	}
+	if first.Cmp(last) > 0 {
+		return []neutron.AllocationPool{}
+	}
+	return []neutron.AllocationPool{
+		{
+			Start: intToIP(first, size).String(),
+			End:   intToIP(last, size).String(),
+		},
+	}
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(ip)
+}
+
+func intToIP(i *big.Int, size int) net.IP {
+	b := i.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
+
+// normalizeCIDRs converts the CIDR filter values to the
+// network address (eg: 10.0.0.1/24 gives 10.0.0.0/24)
+func normalizeCIDRs(values []interface{}) []interface{} {
+	normalized := make([]interface{}, len(values))
+	for i, v := range values {
+		normalized[i] = v
+		if _, ipNet, err := net.ParseCIDR(fmt.Sprintf("%v", v)); err == nil {
+			normalized[i] = ipNet.String()
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/eonpatapon/contrail-gremlin/neutron"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeSubnetRequest(tenantID string, isAdmin bool, data RequestData) *http.Response {
+	return makeRequest("subnet", ListRequest, tenantID, isAdmin, data)
+}
+
+func parseSubnets(resp *http.Response) (subnets []neutron.Subnet) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &subnets)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return subnets
+}
+
+func TestSubnetListUser(t *testing.T) {
+	resp := makeSubnetRequest(tenantID, false, RequestData{})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	subnets := parseSubnets(resp)
+	assert.Equal(t, 5, len(subnets))
+}
+
+func TestSubnetListUserFilterTenant(t *testing.T) {
+	resp := makeSubnetRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"tenant_id": []interface{}{tenantID},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	// the subnets of the external network are not listed
+	subnets := parseSubnets(resp)
+	assert.Equal(t, 3, len(subnets))
+	for _, subnet := range subnets {
+		assert.Equal(t, tenantID, subnet.TenantID)
+	}
+}
+
+func TestSubnetListUserFilterNetwork(t *testing.T) {
+	resp := makeSubnetRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"network_id": []interface{}{"e863c27f-ae81-4c0c-926d-28a95ef8b21f"},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	subnets := parseSubnets(resp)
+	assert.Equal(t, 1, len(subnets))
+	subnet := subnets[0]
+	assert.Equal(t, "99916c2f-f290-4e48-8b99-6fa37f9c5330", subnet.ID.String())
+	assert.Equal(t, "aap_subnet", subnet.Name)
+	assert.Equal(t, "15.15.15.0/24", subnet.CIDR)
+	assert.Equal(t, "15.15.15.1", *subnet.GatewayIP)
+	assert.Equal(t, 4, subnet.IPVersion)
+	assert.Equal(t, true, subnet.EnableDHCP)
+	assert.Equal(t, tenantID, subnet.TenantID)
+	assert.Equal(t, []neutron.AllocationPool{{Start: "15.15.15.2", End: "15.15.15.254"}}, subnet.AllocationPools)
+}
+
+func TestSubnetListUserFilterCIDR(t *testing.T) {
+	resp := makeSubnetRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"cidr":       []interface{}{"10.33.44.0/24", "10.0.0.0/24"},
+			"ip_version": []interface{}{4},
+		},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	subnets := parseSubnets(resp)
+	assert.Equal(t, 2, len(subnets))
+}
+
+func TestSubnetListUserFilterName(t *testing.T) {
+	resp := makeSubnetRequest(tenantID, false, RequestData{
+		Filters: RequestFilters{
+			"name": []interface{}{"sg_subnet"},
+		},
+		Fields: []string{"id", "name"},
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	subnets := parseSubnets(resp)
+	assert.Equal(t, 1, len(subnets))
+	assert.Equal(t, "04613d72-cae0-4cf1-83c6-327d163e238d", subnets[0].ID.String())
+	assert.Equal(t, "", subnets[0].CIDR)
+}
+
+func TestSubnetRead(t *testing.T) {
+	resp := makeRequest("subnet", ReadRequest, tenantID, false, RequestData{
+		ID: "04613d72-cae0-4cf1-83c6-327d163e238d",
+	})
+	assert.Equal(t, 200, resp.StatusCode, "")
+
+	var subnet neutron.Subnet
+	json.NewDecoder(resp.Body).Decode(&subnet)
+	assert.Equal(t, "sg_subnet", subnet.Name)
+	assert.Equal(t, "010e566d-3029-4100-a462-6486eb7e0f0a", subnet.NetworkID.String())
+}
+
+func TestSubnetReadNotFound(t *testing.T) {
+	resp := makeRequest("subnet", ReadRequest, tenantID, false, RequestData{
+		ID: "a5bd9a6d-5d3a-4c0b-9d79-1b0c5e5f3c11",
+	})
+	assert.Equal(t, 404, resp.StatusCode, "")
+
+	err := parseNeutronError(resp)
+	assert.Equal(t, "SubnetNotFound", err["exception"])
+}
+
+func TestSubnetListPaginatedForwarded(t *testing.T) {
+	// contrail-api is not reachable in tests
+	resp := makeSubnetRequest(tenantID, false, RequestData{
+		Limit: 1,
+	})
+	assert.Equal(t, 503, resp.StatusCode, "")
+}
+
+func TestSubnetToNeutron(t *testing.T) {
+	var s ipamSubnet
+	json.Unmarshal([]byte(`{
+		"subnet": {"ip_prefix": "fd00::", "ip_prefix_len": 120},
+		"subnet_uuid": "99916c2f-f290-4e48-8b99-6fa37f9c5330",
+		"default_gateway": "fd00::1",
+		"enable_dhcp": false,
+		"host_routes": {"route": [{"prefix": "10.0.0.0/8", "next_hop": "fd00::2"}]}
+	}`), &s)
+	networkID, _ := uuid.NewV4()
+
+	subnet, err := s.toNeutron(networkID, tenantID)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, subnet.IPVersion)
+	assert.Equal(t, "fd00::/120", subnet.CIDR)
+	assert.Equal(t, false, subnet.EnableDHCP)
+	assert.Equal(t, []neutron.AllocationPool{{Start: "fd00::2", End: "fd00::ff"}}, subnet.AllocationPools)
+	assert.Equal(t, []neutron.HostRoute{{Destination: "10.0.0.0/8", NextHop: "fd00::2"}}, subnet.HostRoutes)
+	assert.Equal(t, []string{}, subnet.DNSNameservers)
+
+	s.DefaultGateway = "0.0.0.0"
+	subnet, _ = s.toNeutron(networkID, tenantID)
+	assert.Nil(t, subnet.GatewayIP)
+	assert.Equal(t, []neutron.AllocationPool{{Start: "fd00::1", End: "fd00::ff"}}, subnet.AllocationPools)
+}
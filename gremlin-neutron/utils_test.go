@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/eonpatapon/contrail-gremlin/testutils"
+	"github.com/eonpatapon/contrail-gremlin/utils"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -60,6 +62,46 @@ func TestFiltersUnmarshal(t *testing.T) {
 
 }
 
+func TestUnfoldFields(t *testing.T) {
+	res, err := unfoldFields([]byte(`[{"id":"a","port_id":[],"router_id":["b"]}]`), "port_id", "router_id", "foo")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[{"id":"a","port_id":null,"router_id":"b"}]`, string(res))
+}
+
+func TestSortKeys(t *testing.T) {
+	keys, orders := sortKeys(RequestData{
+		SortKey: []string{"name", "foo", "fixed_ips", "created_at"},
+		SortDir: []string{"desc", "asc", "asc", "asc"},
+	}, portDefaultFields)
+	assert.Equal(t, []string{"name", "created_at", "id"}, keys)
+	assert.Equal(t, []string{"decr", "incr", "incr"}, orders)
+}
+
+func TestMarkerQuery(t *testing.T) {
+	query := &gremlinQuery{}
+	markerQuery(query, []string{"name", "id"}, []string{"decr", "incr"})
+	name := `coalesce(select('name').unfold().map{UUID.isInstance(it.get())?it.get().toString():it.get()},constant(''))`
+	id := `coalesce(select('id').unfold().map{UUID.isInstance(it.get())?it.get().toString():it.get()},constant(''))`
+	assert.Equal(t, `.or(`+
+		`__.and(__.`+name+`.is(lt(_marker_0))),`+
+		`__.and(__.`+name+`.is(eq(_marker_0)),__.`+id+`.is(gt(_marker_1)))`+
+		`)`, query.String())
+}
+
+func TestHealth(t *testing.T) {
+	resp, err := http.Get("http://localhost:8080/healthz")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	var health utils.Health
+	resp, err = http.Get("http://localhost:8080/readyz")
+	assert.Nil(t, err)
+	json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	assert.Equal(t, utils.HealthOK, health.Components["gremlin"].Status)
+}
+
 func start() {
 	go func() {
 		run("ws://localhost:8182/gremlin", "", "n", implemNames())
@@ -84,3 +126,12 @@ func makeRequest(resourceType string, op RequestOperation, tenantID string, isAd
 	resp, _ := http.Post("http://localhost:8080/neutron/port", "application/json", bytes.NewReader(reqJSON))
 	return resp
 }
+
+func parseNeutronError(resp *http.Response) (res map[string]interface{}) {
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &res)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", string(body), err))
+	}
+	return res
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// BootstrapWorkers is the default number of workers
+	// reading cassandra resources during bootstrap
+	BootstrapWorkers = 10
+)
+
+// bootstrap loads all resources of the contrail DB in the graph.
+//
+// Notifications received during the bootstrap are added to the
+// pending list and processed once all resources are loaded. Transient
+// errors are retried, an error is returned when some resources could
+// not be loaded since the graph is incomplete.
+func (s *Sync) bootstrap(workers int) error {
+	var (
+		uuids  = make(chan uuid.UUID)
+		wg     = &sync.WaitGroup{}
+		read   = new(int64)
+		failed = new(int64)
+	)
+
+	log.Notice("Bootstrapping graph from Cassandra...")
+	start := time.Now()
+
+	for w := 1; w <= workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.bootstrapResources(uuids, read, failed)
+		}()
+	}
+
+	err := utils.GetContrailUUIDs(s.session, uuids)
+	close(uuids)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	log.Noticef("Bootstrap done in %0.2fs [read:%d failed:%d]",
+		time.Now().Sub(start).Seconds(), atomic.LoadInt64(read), atomic.LoadInt64(failed))
+	// the graph is incomplete
+	if n := atomic.LoadInt64(failed); n > 0 {
+		return fmt.Errorf("%d resources failed to load", n)
+	}
+
+	s.pendingProcessing.Store(true)
+	s.bootstrapping.Store(false)
+	if s.backend.Connected() {
+		s.processPendingNotifications()
+	}
+	s.pendingProcessing.Store(false)
+
+	return nil
+}
+
+func (s *Sync) bootstrapResources(uuids <-chan uuid.UUID, read *int64, failed *int64) {
+	batch := make([]g.Vertex, 0, g.UpsertBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := retryTransient(func() error { return s.backend.UpsertVertices(batch) }); err != nil {
+			// find the resources that can't be loaded
+			log.Warningf("Failed to load %d resources, loading them one by one: %s", len(batch), err)
+			for _, vertex := range batch {
+				vs := []g.Vertex{vertex}
+				if err := retryTransient(func() error { return s.backend.UpsertVertices(vs) }); err != nil {
+					log.Errorf("Failed to load %s/%s: %s", vertex.Label, vertex.ID, err)
+					atomic.AddInt64(failed, 1)
+				}
+			}
+		}
+		batch = batch[:0]
+	}
+	for uuid := range uuids {
+		var vertex g.Vertex
+		err := retryTransient(func() (err error) {
+			vertex, err = s.getContrailResource(uuid)
+			return err
+		})
+		switch err {
+		case nil:
+			atomic.AddInt64(read, 1)
+			batch = append(batch, vertex)
+			if len(batch) == g.UpsertBatchSize {
+				flush()
+			}
+		// the resource was deleted since the uuid was listed
+		case utils.ErrResourceNotFound:
+		default:
+			log.Errorf("Failed to retrieve resource %s from db: %s", uuid, err)
+			atomic.AddInt64(failed, 1)
+		}
+	}
+	flush()
+}
+
+// retryTransient calls f until it succeeds or returns
+// an error that is not transient, with a backoff
+func retryTransient(f func() error) error {
+	interval := RetryInterval
+	for retry := 0; ; retry++ {
+		err := f()
+		if err == nil || !isTransientError(err) || retry == MaxRetries {
+			return err
+		}
+		log.Warningf("Retrying in %s: %s", interval, err)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/eonpatapon/contrail-gremlin/utils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// ErrGremlinDisconnected indicates that gremlin server is not reachable
+	ErrGremlinDisconnected = errors.New("not connected to gremlin server")
+	// ErrBootstrapping indicates that the graph is being loaded
+	ErrBootstrapping = errors.New("bootstrap in progress")
+	// LivenessTimeout is the time a connection can stay
+	// lost before the process is not alive anymore
+	LivenessTimeout = 5 * time.Minute
+)
+
+// healthChecks returns the liveness and readiness checks of the sync process.
+//
+// The process reconnects to its dependencies so it is alive until a
+// connection stays lost for more than LivenessTimeout. It is ready
+// when all its dependencies are reachable.
+func (s *Sync) healthChecks(rabbit *Consumer) (live []utils.HealthCheck, ready []utils.HealthCheck) {
+	live = []utils.HealthCheck{
+		{Name: "rabbitmq", Check: utils.FailingFor(rabbit.Check, LivenessTimeout)},
+		{Name: "gremlin", Check: utils.FailingFor(s.checkGremlin, LivenessTimeout)},
+	}
+	ready = []utils.HealthCheck{
+		{Name: "rabbitmq", Check: rabbit.Check},
+		{Name: "gremlin", Check: s.checkGremlin},
+		{Name: "cassandra", Check: func() error {
+			return s.session.Exec("SELECT now() FROM system.local")
+		}},
+		{Name: "bootstrap", Check: func() error {
+			if s.bootstrapping.Load() == true {
+				return ErrBootstrapping
+			}
+			return nil
+		}},
+	}
+	return live, ready
+}
+
+func (s *Sync) checkGremlin() error {
+	if !s.backend.Connected() {
+		return ErrGremlinDisconnected
+	}
+	return nil
+}
+
+// serveHTTP exposes the metrics and the health
+// of the sync process on addr
+func (s *Sync) serveHTTP(addr string, rabbit *Consumer) {
+	live, ready := s.healthChecks(rabbit)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", utils.HealthHandler(live))
+	mux.Handle("/readyz", utils.HealthHandler(ready))
+	log.Noticef("Serving metrics and health on %s", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("HTTP server error: %s", err)
+		}
+	}()
+}
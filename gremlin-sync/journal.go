@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// JournalCompactThreshold is the number of extra entries
+	// allowed in the journal before it is compacted
+	JournalCompactThreshold = 1000
+)
+
+const (
+	journalAdd  = "add"
+	journalDone = "done"
+)
+
+type journalEntry struct {
+	Op           string        `json:"op"`
+	Notification *Notification `json:"notification,omitempty"`
+}
+
+// Journal is an append-only file backing the pending notifications list.
+//
+// Added notifications are written with an "add" entry and synced to disk
+// before the notification is acknowledged. Processed notifications are
+// written with a "done" entry that removes the first notification of the
+// list. The list is rebuilt by replaying the entries with the same rules
+// used to build the pending list.
+type Journal struct {
+	path    string
+	file    *os.File
+	entries int
+	sync.Mutex
+}
+
+// OpenJournal opens the journal at path and returns the
+// pending notifications it contains
+func OpenJournal(path string) (*Journal, []Notification, error) {
+	j := &Journal{path: path}
+	pending, err := j.replay()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Start from a clean file
+	if err := j.Compact(pending); err != nil {
+		return nil, nil, err
+	}
+	return j, pending, nil
+}
+
+func (j *Journal) replay() ([]Notification, error) {
+	pending := []Notification{}
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return pending, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// The last entry may have been partially written
+			log.Warningf("Ignoring invalid journal entry %s: %s", scanner.Text(), err)
+			continue
+		}
+		switch e.Op {
+		case journalAdd:
+			if e.Notification != nil {
+				pending = addPendingNotification(pending, *e.Notification)
+			}
+		case journalDone:
+			if len(pending) > 0 {
+				pending = pending[1:]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	log.Noticef("Loaded %d pending notifications from %s", len(pending), j.path)
+	return pending, nil
+}
+
+func (j *Journal) write(e journalEntry, flush bool) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	j.entries++
+	if flush {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// Add writes the notification to the journal. The
+// notification is on disk when Add returns.
+func (j *Journal) Add(n Notification) error {
+	j.Lock()
+	defer j.Unlock()
+	return j.write(journalEntry{Op: journalAdd, Notification: &n}, true)
+}
+
+// Done removes the first notification of the journal. The entry
+// is not synced: replaying an already processed notification is harmless.
+func (j *Journal) Done() error {
+	j.Lock()
+	defer j.Unlock()
+	return j.write(journalEntry{Op: journalDone}, false)
+}
+
+// ShouldCompact returns true when the journal is much
+// bigger than the given pending list
+func (j *Journal) ShouldCompact(pending []Notification) bool {
+	j.Lock()
+	defer j.Unlock()
+	return len(pending) == 0 && j.entries > 0 ||
+		j.entries > 2*len(pending)+JournalCompactThreshold
+}
+
+// Compact replaces the journal content with the pending list
+func (j *Journal) Compact(pending []Notification) error {
+	j.Lock()
+	defer j.Unlock()
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for i := range pending {
+		data, err := json.Marshal(journalEntry{Op: journalAdd, Notification: &pending[i]})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(j.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	j.entries = len(pending)
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
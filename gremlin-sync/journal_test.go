@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/willfaught/gockle"
+)
+
+func TestJournalReplay(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gremlin-sync")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	notifications := []Notification{
+		Notification{Oper: "CREATE", Type: "foo", UUID: id1},
+		Notification{Oper: "UPDATE", Type: "foo", UUID: id1},
+		Notification{Oper: "CREATE", Type: "bar", UUID: id2},
+		Notification{Oper: "UPDATE", Type: "foo", UUID: id1},
+		Notification{Oper: "DELETE", Type: "bar", UUID: id2},
+	}
+
+	j, pending, err := OpenJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pending))
+	for _, n := range notifications {
+		j.Add(n)
+		pending = addPendingNotification(pending, n)
+	}
+	j.Done()
+	pending = pending[1:]
+	j.Close()
+
+	// Simulate a partial write
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.Write([]byte(`{"op":"add","notif`))
+	f.Close()
+
+	j, replayed, err := OpenJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []Notification{
+		Notification{Oper: "UPDATE", Type: "foo", UUID: id1},
+		Notification{Oper: "DELETE", Type: "bar", UUID: id2},
+	}, pending)
+	assert.Equal(t, pending, replayed)
+	j.Close()
+}
+
+func TestJournalCompact(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gremlin-sync")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	id1, _ := uuid.NewV4()
+	n := Notification{Oper: "UPDATE", Type: "foo", UUID: id1}
+
+	j, pending, _ := OpenJournal(path)
+	for i := 0; i < JournalCompactThreshold+10; i++ {
+		j.Add(n)
+		pending = addPendingNotification(pending, n)
+	}
+	assert.Equal(t, 1, len(pending))
+	assert.True(t, j.ShouldCompact(pending))
+
+	err := j.Compact(pending)
+	assert.Nil(t, err)
+	assert.False(t, j.ShouldCompact(pending))
+	j.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, `{"op":"add","notification":{"oper":"UPDATE","type":"foo","uuid":"`+id1.String()+`"}}`+"\n", string(data))
+}
+
+func TestJournalPendingFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gremlin-sync")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	id1, _ := uuid.NewV4()
+	n := Notification{Oper: "UPDATE", Type: "foo", UUID: id1}
+
+	query := "SELECT key, column1, value FROM obj_uuid_table WHERE key=?"
+	session := &gockle.SessionMock{}
+	session.When("ScanMapSlice", query, []interface{}{id1.String()}).Return(
+		[]map[string]interface{}(nil),
+		errors.New("Fake read error"),
+	)
+
+	sync := NewSync(session, make(chan amqp.Delivery), gremlinURI)
+	err := sync.openJournal(path)
+	assert.Nil(t, err)
+	sync.handlePendingNotification(n)
+
+	// the notification can't be handled, it is kept
+	sync.pendingProcessing.Store(true)
+	sync.processPendingNotifications()
+	sync.pendingProcessing.Store(false)
+	assert.Equal(t, []Notification{n}, sync.pending)
+	sync.journal.Close()
+
+	j, replayed, err := OpenJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []Notification{n}, replayed)
+	j.Close()
+}
+
+func TestKeepDeliveryJournalFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gremlin-sync")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	id1, _ := uuid.NewV4()
+	n := Notification{Oper: "UPDATE", Type: "foo", UUID: id1}
+	ack := fakeAcknowledger{
+		acks:  make(chan bool, 1),
+		nacks: make(chan bool, 1),
+	}
+
+	sync := NewSync(&gockle.SessionMock{}, make(chan amqp.Delivery), gremlinURI)
+	err := sync.openJournal(path)
+	assert.Nil(t, err)
+
+	sync.keepDelivery(delivery{Delivery: amqp.Delivery{Acknowledger: ack}, n: n})
+	assert.True(t, <-ack.acks)
+	assert.Equal(t, []Notification{n}, sync.pending)
+
+	// the notification can't be journaled, it is kept in the queue
+	sync.journal.Close()
+	sync.keepDelivery(delivery{Delivery: amqp.Delivery{Acknowledger: ack}, n: n})
+	assert.True(t, <-ack.nacks)
+	assert.Equal(t, []Notification{n}, sync.pending)
+}
@@ -1,32 +1,206 @@
 package main
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/streadway/amqp"
 )
 
-func setupRabbit(rabbitURI string, rabbitVHost string, rabbitQueue string) (*amqp.Connection, *amqp.Channel, <-chan amqp.Delivery) {
+var (
+	// ErrRabbitClosed indicates that the rabbitmq connection was closed
+	ErrRabbitClosed = errors.New("rabbitmq connection closed")
+	// RabbitRetryInterval is the time to wait before the first
+	// reconnection, it is doubled after each failed attempt
+	RabbitRetryInterval = 1 * time.Second
+	// RabbitMaxRetryInterval is the maximum time to
+	// wait between two reconnections
+	RabbitMaxRetryInterval = 30 * time.Second
+)
+
+type rabbitErr struct {
+	err error
+}
+
+// Consumer consumes the notifications of the sync queue and
+// reconnects to rabbitmq when the connection is lost.
+//
+// The queue is exclusive so it is deleted on disconnection,
+// notifications sent during the outage are lost.
+type Consumer struct {
+	uri                 string
+	vhost               string
+	queue               string
+	dlx                 string
+	prefetch            int
+	conn                *amqp.Connection
+	ch                  *amqp.Channel
+	msgs                chan amqp.Delivery
+	err                 atomic.Value
+	reconnectedHandlers []func(time.Time)
+	quit                chan bool
+	sync.Mutex
+}
+
+// NewConsumer returns a consumer of the queue bound to VncExchange
+func NewConsumer(uri string, vhost string, queue string, dlx string, prefetch int) *Consumer {
+	c := &Consumer{
+		uri:                 uri,
+		vhost:               vhost,
+		queue:               queue,
+		dlx:                 dlx,
+		prefetch:            prefetch,
+		msgs:                make(chan amqp.Delivery),
+		reconnectedHandlers: []func(time.Time){},
+		quit:                make(chan bool),
+	}
+	c.err.Store(rabbitErr{err: ErrRabbitClosed})
+	return c
+}
+
+// Deliveries returns the notifications of the queue. The
+// channel is kept open across reconnections.
+func (c *Consumer) Deliveries() <-chan amqp.Delivery {
+	return c.msgs
+}
+
+// AddReconnectedHandler runs handler after a reconnection
+// with the time the connection was lost
+func (c *Consumer) AddReconnectedHandler(h func(time.Time)) {
+	c.reconnectedHandlers = append(c.reconnectedHandlers, h)
+}
+
+// Check returns an error when the consumer is not connected
+func (c *Consumer) Check() error {
+	return c.err.Load().(rabbitErr).err
+}
+
+// Start connects to rabbitmq, retrying until the
+// connection succeeds, and starts consuming the queue
+func (c *Consumer) Start() {
+	deliveries := c.connectWithRetry()
+	go c.consume(deliveries)
+}
+
+// Stop deletes the queue and closes the connection
+func (c *Consumer) Stop() error {
+	c.Lock()
+	defer c.Unlock()
+	close(c.quit)
+	if c.conn == nil {
+		return nil
+	}
+	err := c.ch.QueueUnbind(c.queue, "", VncExchange, amqp.Table{})
+	if err != nil {
+		return err
+	}
+	_, err = c.ch.QueueDelete(c.queue, false, false, true)
+	if err != nil {
+		return err
+	}
+	return c.conn.Close()
+}
+
+func (c *Consumer) consume(deliveries <-chan amqp.Delivery) {
+	defer close(c.msgs)
+	for deliveries != nil {
+		for d := range deliveries {
+			c.msgs <- d
+		}
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+		disconnectedAt := time.Now()
+		c.err.Store(rabbitErr{err: ErrRabbitClosed})
+		deliveries = c.connectWithRetry()
+		if deliveries != nil {
+			for _, h := range c.reconnectedHandlers {
+				h(disconnectedAt)
+			}
+		}
+	}
+}
+
+// connectWithRetry connects with an exponential backoff,
+// it returns nil if the consumer is stopped meanwhile
+func (c *Consumer) connectWithRetry() <-chan amqp.Delivery {
+	interval := RabbitRetryInterval
+	for {
+		deliveries, err := c.connect()
+		if err == nil {
+			c.err.Store(rabbitErr{})
+			return deliveries
+		}
+		if err == ErrRabbitClosed {
+			return nil
+		}
+		c.err.Store(rabbitErr{err: err})
+		log.Errorf("Failed to connect to RabbitMQ: %s, retrying in %s", err, interval)
+		select {
+		case <-time.After(interval):
+		case <-c.quit:
+			return nil
+		}
+		interval *= 2
+		if interval > RabbitMaxRetryInterval {
+			interval = RabbitMaxRetryInterval
+		}
+	}
+}
+
+// connect declares and binds the queue to VncExchange and
+// returns its deliveries
+func (c *Consumer) connect() (<-chan amqp.Delivery, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	select {
+	case <-c.quit:
+		return nil, ErrRabbitClosed
+	default:
+	}
+
 	log.Notice("Connecting to RabbitMQ...")
 
-	conn, err := amqp.DialConfig(rabbitURI, amqp.Config{Vhost: rabbitVHost})
+	conn, err := amqp.DialConfig(c.uri, amqp.Config{Vhost: c.vhost})
 	if err != nil {
-		log.Fatalf("Failed to connect: %s", err)
+		return nil, err
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
-		log.Fatalf("Failed to open channel: %s", err)
+		conn.Close()
+		return nil, err
+	}
+
+	// limit the number of unacknowledged notifications
+	// to what the workers can process
+	if err := ch.Qos(c.prefetch, 0, false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	args := amqp.Table{"x-expires": int32(180000)}
+	// rejected notifications are routed to the dead-letter exchange
+	if c.dlx != "" {
+		args["x-dead-letter-exchange"] = c.dlx
 	}
 
 	q, err := ch.QueueDeclare(
-		rabbitQueue, // name
-		false,       // durable
-		false,       // delete when unused
-		true,        // exclusive
-		false,       // no-wait
-		amqp.Table{"x-expires": int32(180000)}, // arguments
+		c.queue, // name
+		false,   // durable
+		false,   // delete when unused
+		true,    // exclusive
+		false,   // no-wait
+		args,    // arguments
 	)
 	if err != nil {
-		log.Fatalf("Failed to create queue: %s", err)
+		conn.Close()
+		return nil, err
 	}
 
 	err = ch.QueueBind(
@@ -37,7 +211,8 @@ func setupRabbit(rabbitURI string, rabbitVHost string, rabbitQueue string) (*amq
 		nil,
 	)
 	if err != nil {
-		log.Fatalf("Failed to bind queue: %s", err)
+		conn.Close()
+		return nil, err
 	}
 
 	msgs, err := ch.Consume(
@@ -50,22 +225,21 @@ func setupRabbit(rabbitURI string, rabbitVHost string, rabbitQueue string) (*amq
 		nil,    // args
 	)
 	if err != nil {
-		log.Fatalf("Failed to register consumer: %s", err)
+		conn.Close()
+		return nil, err
 	}
 
-	log.Notice("Connected.")
+	closes := conn.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		if err := <-closes; err != nil {
+			log.Errorf("Disconnected from RabbitMQ: %s", err)
+		}
+	}()
 
-	return conn, ch, msgs
-}
+	c.conn = conn
+	c.ch = ch
 
-func teardownRabbit(conn *amqp.Connection, ch *amqp.Channel, rabbitQueue string) error {
-	err := ch.QueueUnbind(rabbitQueue, "", VncExchange, amqp.Table{})
-	if err != nil {
-		return err
-	}
-	_, err = ch.QueueDelete(rabbitQueue, false, false, true)
-	if err != nil {
-		return err
-	}
-	return conn.Close()
+	log.Notice("Connected.")
+
+	return msgs, nil
 }
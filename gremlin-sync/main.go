@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"os"
 	"os/signal"
 	"sync"
@@ -32,6 +33,12 @@ const (
 	VncExchange = "vnc_config.object-update"
 	// QueueName is the rabbitmq queue for the sync process
 	QueueName = "gremlin.sync"
+	// SyncWorkers is the default number of workers
+	// processing notifications concurrently
+	SyncWorkers = 10
+	// PrefetchPerWorker is the number of unacknowledged
+	// notifications rabbitmq delivers for each worker
+	PrefetchPerWorker = 10
 )
 
 // Notification represent rabbitmq notifications from contrail-api
@@ -41,13 +48,28 @@ type Notification struct {
 	UUID uuid.UUID `json:"uuid"`
 }
 
+// delivery is a rabbitmq delivery with its decoded notification.
+// Reconciliation writes are dispatched as deliveries with only a task.
+type delivery struct {
+	amqp.Delivery
+	n    Notification
+	task func()
+}
+
 // Sync represent the state of the sync process
 type Sync struct {
 	backend           *g.ServerBackend
 	session           gockle.Session
 	msgs              <-chan amqp.Delivery
 	pending           []Notification
+	pendingLock       sync.Mutex
 	pendingProcessing atomic.Value
+	bootstrapping     atomic.Value
+	journal           *Journal
+	stats             SyncStats
+	workers           int
+	shards            []chan delivery
+	shardsLock        sync.RWMutex
 	wg                *sync.WaitGroup
 }
 
@@ -58,14 +80,30 @@ func NewSync(session gockle.Session, msgs <-chan amqp.Delivery, gremlinURI strin
 		session: session,
 		msgs:    msgs,
 		pending: []Notification{},
+		workers: SyncWorkers,
 		wg:      &sync.WaitGroup{},
 	}
 	s.pendingProcessing.Store(false)
+	s.bootstrapping.Store(false)
 	s.backend.AddConnectedHandler(s.onConnected)
 	s.backend.AddDisconnectedHandler(s.onDisconnected)
+	s.backend.AddQueryHandler(observeGremlinQuery)
 	return s
 }
 
+// openJournal backs the pending notifications list with
+// the journal at path and loads its notifications
+func (s *Sync) openJournal(path string) error {
+	journal, pending, err := OpenJournal(path)
+	if err != nil {
+		return err
+	}
+	s.journal = journal
+	s.pending = pending
+	pendingNotifications.Set(float64(len(pending)))
+	return nil
+}
+
 func (s *Sync) start() {
 	log.Notice("Connecting to Gremlin Server...")
 	s.backend.Start()
@@ -75,11 +113,18 @@ func (s *Sync) stop() {
 	s.wg.Wait()
 	s.backend.Stop()
 	log.Notice("Disconnected from Gremlin Server.")
+	if s.journal != nil {
+		s.journal.Close()
+	}
 }
 
 func (s *Sync) onConnected() {
 	log.Notice("Connected to Gremlin Server")
-	if len(s.pending) > 0 {
+	// pending notifications are processed at the end of the bootstrap
+	if s.bootstrapping.Load() == true {
+		return
+	}
+	if s.pendingCount() > 0 {
 		s.pendingProcessing.Store(true)
 		s.processPendingNotifications()
 		s.pendingProcessing.Store(false)
@@ -92,15 +137,90 @@ func (s *Sync) onDisconnected(err error) {
 	}
 }
 
+// synchronize dispatches the notifications to the workers.
+//
+// Notifications are sharded by UUID so that the notifications
+// of a resource are processed in order by the same worker. A
+// worker that retries a notification must not block the others:
+// each shard can hold all the unacknowledged notifications
+// prefetched from rabbitmq and the running reconciliation tasks
+// so that dispatching never blocks.
 func (s *Sync) synchronize() {
-	log.Debug("Listening for updates")
+	var (
+		shards = make([]chan delivery, s.workers)
+		wg     = &sync.WaitGroup{}
+	)
+
+	log.Debugf("Listening for updates [workers:%d]", s.workers)
+	for i := range shards {
+		shards[i] = make(chan delivery, s.workers*PrefetchPerWorker+ReconcileWorkers)
+		wg.Add(1)
+		go func(deliveries <-chan delivery) {
+			defer wg.Done()
+			s.processDeliveries(deliveries)
+		}(shards[i])
+	}
+	s.shardsLock.Lock()
+	s.shards = shards
+	s.shardsLock.Unlock()
+
 	for d := range s.msgs {
 		n := Notification{}
-		json.Unmarshal(d.Body, &n)
+		if err := json.Unmarshal(d.Body, &n); err != nil {
+			s.deadLetter(d, err)
+			continue
+		}
+		notificationsReceived.WithLabelValues(n.Oper, n.Type).Inc()
+		shards[shard(n.UUID, s.workers)] <- delivery{Delivery: d, n: n}
+	}
 
-		if s.backend.Connected() == false {
-			s.handlePendingNotification(n)
-			d.Ack(false)
+	s.shardsLock.Lock()
+	s.shards = nil
+	s.shardsLock.Unlock()
+	for _, deliveries := range shards {
+		close(deliveries)
+	}
+	wg.Wait()
+}
+
+// runInShard runs task in the worker handling the notifications
+// of the resource u and waits for its completion. The task is run
+// directly when the notifications are not dispatched.
+func (s *Sync) runInShard(u uuid.UUID, task func()) {
+	s.shardsLock.RLock()
+	if s.shards == nil {
+		s.shardsLock.RUnlock()
+		task()
+		return
+	}
+	done := make(chan bool)
+	s.shards[shard(u, len(s.shards))] <- delivery{task: func() {
+		defer close(done)
+		task()
+	}}
+	s.shardsLock.RUnlock()
+	<-done
+}
+
+// shard returns the index of the worker handling the
+// notifications of the resource u
+func shard(u uuid.UUID, workers int) int {
+	h := fnv.New32a()
+	h.Write(u.Bytes())
+	return int(h.Sum32() % uint32(workers))
+}
+
+func (s *Sync) processDeliveries(deliveries <-chan delivery) {
+	for d := range deliveries {
+		if d.task != nil {
+			d.task()
+			continue
+		}
+
+		n := d.n
+
+		if s.backend.Connected() == false || s.bootstrapping.Load() == true {
+			s.keepDelivery(d)
 			continue
 		}
 
@@ -108,63 +228,156 @@ func (s *Sync) synchronize() {
 			time.Sleep(200 * time.Millisecond)
 		}
 
-		if err := s.handleNotification(n); err != nil {
+		switch err := s.handleNotificationWithRetry(n); err {
+		case nil:
+			notificationsProcessed.WithLabelValues(n.Oper, n.Type).Inc()
 			d.Ack(false)
-		} else {
-			d.Nack(false, false)
+		case gremlin.ErrConnectionClosed:
+			s.keepDelivery(d)
+		default:
+			notificationsFailed.WithLabelValues(n.Oper, n.Type).Inc()
+			s.deadLetter(d.Delivery, err)
 		}
 	}
 }
 
-func (s *Sync) handlePendingNotification(n Notification) {
+// keepDelivery adds the notification of the delivery to the pending
+// list. The delivery is kept in the queue if it can't be journaled.
+func (s *Sync) keepDelivery(d delivery) {
+	if err := s.handlePendingNotification(d.n); err != nil {
+		d.Nack(false, true)
+	} else {
+		d.Ack(false)
+	}
+}
+
+func (s *Sync) handlePendingNotification(n Notification) error {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	if s.journal != nil {
+		if err := s.journal.Add(n); err != nil {
+			log.Errorf("[%s] %s/%s failed to write journal: %s", n.Oper, n.Type, n.UUID, err)
+			return err
+		}
+	}
+	s.pending = addPendingNotification(s.pending, n)
+	pendingNotifications.Set(float64(len(s.pending)))
+	log.Debugf("[%s] %s/%s [+]", n.Oper, n.Type, n.UUID)
+	return nil
+}
+
+func addPendingNotification(p []Notification, n Notification) []Notification {
 	switch n.Oper {
 	// On DELETE, remove previous notifications in the pending list
 	case "DELETE":
-		for i := 0; i < len(s.pending); i++ {
-			n2 := s.pending[i]
+		for i := 0; i < len(p); i++ {
+			n2 := p[i]
 			if n2.UUID == n.UUID {
-				s.pending = s.removePendingNotification(s.pending, n2, i)
+				p = removePendingNotification(p, n2, i)
 				i--
 			}
 		}
 	// Reduce resource updates
 	case "UPDATE":
-		for i := 0; i < len(s.pending); i++ {
-			n2 := s.pending[i]
+		for i := 0; i < len(p); i++ {
+			n2 := p[i]
 			if n2.UUID == n.UUID && n2.Oper == n.Oper {
-				s.pending = s.removePendingNotification(s.pending, n2, i)
+				p = removePendingNotification(p, n2, i)
 				i--
 			}
 		}
 	}
-	s.pending = append(s.pending, n)
-	log.Debugf("[%s] %s/%s [+]", n.Oper, n.Type, n.UUID)
+	return append(p, n)
 }
 
-func (s *Sync) removePendingNotification(p []Notification, n Notification, i int) []Notification {
+func removePendingNotification(p []Notification, n Notification, i int) []Notification {
 	log.Debugf("[%s] %s/%s [-]", n.Oper, n.Type, n.UUID)
 	return append(p[:i], p[i+1:]...)
 }
 
+// processPendingNotifications handles the notifications of the pending
+// list. The pending lock is not held while a notification is handled
+// so that notifications can be added to the list meanwhile.
+//
+// Notifications that can't be handled are kept at the end of the
+// list and handled again at the next run.
 func (s *Sync) processPendingNotifications() {
 	log.Debugf("Processing pending notifications...")
-	pending := s.pending
-	for _, n := range pending {
-		err := s.handleNotification(n)
-		if err == gremlin.ErrConnectionClosed {
+	var failed []Notification
+	for count := s.pendingCount(); count > 0; count-- {
+		s.pendingLock.Lock()
+		if len(s.pending) == 0 {
+			s.pendingLock.Unlock()
+			break
+		}
+		n := s.pending[0]
+		s.pendingLock.Unlock()
+
+		err := s.handleNotificationWithRetry(n)
+		switch err {
+		case nil:
+			notificationsProcessed.WithLabelValues(n.Oper, n.Type).Inc()
+		case gremlin.ErrConnectionClosed:
 			log.Errorf("Disconnected while processing pending list.")
+			s.keepPendingNotifications(failed)
 			return
+		default:
+			notificationsFailed.WithLabelValues(n.Oper, n.Type).Inc()
+			log.Errorf("[%s] %s/%s kept in pending list: %s", n.Oper, n.Type, n.UUID, err)
+			failed = append(failed, n)
+		}
+		s.popPendingNotification(n)
+	}
+	s.keepPendingNotifications(failed)
+
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	if s.journal != nil && s.journal.ShouldCompact(s.pending) {
+		if err := s.journal.Compact(s.pending); err != nil {
+			log.Errorf("Failed to compact journal: %s", err)
 		}
-		s.pending = s.pending[1:]
 	}
 	log.Debugf("Done.")
 }
 
+func (s *Sync) pendingCount() int {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	return len(s.pending)
+}
+
+// popPendingNotification removes n from the head of the pending list.
+// When notifications were added while n was handled, n may have been
+// reduced and is not at the head anymore.
+func (s *Sync) popPendingNotification(n Notification) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	if len(s.pending) == 0 || s.pending[0] != n {
+		return
+	}
+	s.pending = s.pending[1:]
+	pendingNotifications.Set(float64(len(s.pending)))
+	if s.journal != nil {
+		if err := s.journal.Done(); err != nil {
+			log.Errorf("Failed to write journal: %s", err)
+		}
+	}
+}
+
+// keepPendingNotifications adds back failed notifications to
+// the pending list and the journal
+func (s *Sync) keepPendingNotifications(ns []Notification) {
+	for _, n := range ns {
+		if err := s.handlePendingNotification(n); err != nil {
+			log.Errorf("[%s] %s/%s lost: %s", n.Oper, n.Type, n.UUID, err)
+		}
+	}
+}
+
+// handleNotificationError logs the error of a notification. On
+// connection loss, the caller adds the notification to the pending list.
 func (s *Sync) handleNotificationError(n Notification, err error) error {
 	log.Errorf("[%s] %s/%s failed: %s", n.Oper, n.Type, n.UUID, err)
-	if s.pendingProcessing.Load() == false && err == gremlin.ErrConnectionClosed {
-		s.handlePendingNotification(n)
-	}
 	return err
 }
 
@@ -172,7 +385,7 @@ func (s *Sync) handleNotification(n Notification) error {
 	log.Debugf("[%s] %s/%s", n.Oper, n.Type, n.UUID)
 	switch n.Oper {
 	case "CREATE":
-		vertex, err := utils.GetContrailResource(s.session, n.UUID)
+		vertex, err := s.getContrailResource(n.UUID)
 		if err != nil {
 			return s.handleNotificationError(n, err)
 		}
@@ -182,7 +395,7 @@ func (s *Sync) handleNotification(n Notification) error {
 		}
 		return nil
 	case "UPDATE":
-		vertex, err := utils.GetContrailResource(s.session, n.UUID)
+		vertex, err := s.getContrailResource(n.UUID)
 		if err != nil {
 			return s.handleNotificationError(n, err)
 		}
@@ -211,14 +424,17 @@ func (s *Sync) checkDeleteLater(v g.Vertex, n Notification) {
 		s.wg.Add(1)
 		defer s.wg.Done()
 		time.Sleep(DeleteInterval)
-		s.checkDelete(v, n)
+		if err := s.checkDelete(v, n); err == gremlin.ErrConnectionClosed {
+			s.keepPendingNotifications([]Notification{n})
+		}
 	}()
 }
 
-func (s Sync) checkDelete(v g.Vertex, n Notification) error {
-	cv, err := utils.GetContrailResource(s.session, v.ID)
+func (s *Sync) checkDelete(v g.Vertex, n Notification) error {
+	cv, err := s.getContrailResource(v.ID)
 	switch err {
 	case utils.ErrResourceNotFound:
+		deleteChecks.WithLabelValues("deleted").Inc()
 		err := s.backend.DeleteVertex(v)
 		if err != nil {
 			return s.handleNotificationError(n, err)
@@ -226,6 +442,7 @@ func (s Sync) checkDelete(v g.Vertex, n Notification) error {
 	// the vertex is still present in the DB
 	// but should have been deleted
 	case nil:
+		deleteChecks.WithLabelValues("present").Inc()
 		log.Errorf("Resource %s/%s is still present in DB", v.Label, v.ID)
 		// the resource is not deleted completely
 		if cv.HasProp("_incomplete") {
@@ -243,31 +460,56 @@ func (s Sync) checkDelete(v g.Vertex, n Notification) error {
 	return nil
 }
 
-func setup(gremlinURI string, cassandraCluster []string, rabbitURI string, rabbitVHost string, rabbitQueue string) {
+func setup(gremlinURI string, cassandraConfig utils.CassandraConfig, rabbitURI string, rabbitVHost string, rabbitQueue string, rabbitDLX string, workers int, bootstrap bool, bootstrapWorkers int, reconcileInterval int, journalPath string, listenAddr string) {
 	var (
-		conn    *amqp.Connection
-		ch      *amqp.Channel
-		msgs    <-chan amqp.Delivery
 		session gockle.Session
 		err     error
 	)
 
 	log.Notice("Connecting to Cassandra...")
-	session, err = utils.SetupCassandra(cassandraCluster)
+	session, err = utils.SetupCassandra(cassandraConfig)
 	if err != nil {
 		log.Fatalf("Failed to connect to Cassandra: %s", err)
 	}
 	log.Notice("Connected.")
 	defer session.Close()
 
-	conn, ch, msgs = setupRabbit(rabbitURI, rabbitVHost, rabbitQueue)
-	defer teardownRabbit(conn, ch, rabbitQueue)
+	consumer := NewConsumer(rabbitURI, rabbitVHost, rabbitQueue, rabbitDLX, workers*PrefetchPerWorker)
+	consumer.Start()
+	defer consumer.Stop()
 
-	sync := NewSync(session, msgs, gremlinURI)
+	sync := NewSync(session, consumer.Deliveries(), gremlinURI)
+	sync.workers = workers
+	if listenAddr != "" {
+		registerMetrics(sync)
+		sync.serveHTTP(listenAddr, consumer)
+	}
+	if journalPath != "" {
+		if err := sync.openJournal(journalPath); err != nil {
+			log.Fatalf("Failed to open journal %s: %s", journalPath, err)
+		}
+	}
+	if bootstrap {
+		sync.bootstrapping.Store(true)
+	}
 	go sync.synchronize()
 	sync.start()
 	defer sync.stop()
 
+	if bootstrap {
+		if err := sync.bootstrap(bootstrapWorkers); err != nil {
+			log.Fatalf("Failed to bootstrap: %s", err)
+		}
+	}
+
+	reconciler := NewReconciler(sync, time.Duration(reconcileInterval)*time.Second)
+	defer reconciler.stop()
+	if reconcileInterval > 0 {
+		reconciler.start()
+	}
+	// notifications are lost while rabbitmq is not reachable
+	consumer.AddReconnectedHandler(reconciler.reconcileOutage)
+
 	log.Notice("To exit press CTRL+C")
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM)
@@ -283,12 +525,8 @@ func main() {
 		Desc:   "host:port of gremlin server",
 		EnvVar: "GREMLIN_SYNC_GREMLIN_SERVER",
 	})
-	cassandraSrvs := app.Strings(cli.StringsOpt{
-		Name:   "cassandra",
-		Value:  []string{"localhost"},
-		Desc:   "list of host of cassandra nodes, uses CQL port 9042",
-		EnvVar: "GREMLIN_SYNC_CASSANDRA_SERVERS",
-	})
+	cassandraConfig := utils.CassandraOptions(app, "GREMLIN_SYNC")
+	setupTransforms := utils.TransformOptions(app, "GREMLIN_SYNC")
 	rabbitSrv := app.String(cli.StringOpt{
 		Name:   "rabbit",
 		Value:  "localhost:5672",
@@ -318,13 +556,60 @@ func main() {
 		Desc:   "name of rabbitmq name",
 		EnvVar: "GREMLIN_SYNC_RABBIT_QUEUE",
 	})
+	rabbitDLX := app.String(cli.StringOpt{
+		Name:   "rabbit-dead-letter-exchange",
+		Value:  "",
+		Desc:   "rabbitmq exchange receiving notifications that can't be processed",
+		EnvVar: "GREMLIN_SYNC_RABBIT_DEAD_LETTER_EXCHANGE",
+	})
+	workers := app.Int(cli.IntOpt{
+		Name:   "workers",
+		Value:  SyncWorkers,
+		Desc:   "number of workers processing notifications concurrently",
+		EnvVar: "GREMLIN_SYNC_WORKERS",
+	})
+	bootstrap := app.Bool(cli.BoolOpt{
+		Name:   "bootstrap",
+		Value:  false,
+		Desc:   "load all resources from cassandra before applying notifications",
+		EnvVar: "GREMLIN_SYNC_BOOTSTRAP",
+	})
+	bootstrapWorkers := app.Int(cli.IntOpt{
+		Name:   "bootstrap-workers",
+		Value:  BootstrapWorkers,
+		Desc:   "number of workers reading cassandra resources during bootstrap",
+		EnvVar: "GREMLIN_SYNC_BOOTSTRAP_WORKERS",
+	})
+	reconcileInterval := app.Int(cli.IntOpt{
+		Name:   "reconcile-interval",
+		Value:  0,
+		Desc:   "interval in seconds between reconciliations of the graph with cassandra, 0 to disable",
+		EnvVar: "GREMLIN_SYNC_RECONCILE_INTERVAL",
+	})
+	journalPath := app.String(cli.StringOpt{
+		Name:   "journal",
+		Value:  "",
+		Desc:   "path of the file keeping pending notifications while gremlin server is down",
+		EnvVar: "GREMLIN_SYNC_JOURNAL",
+	})
+	listenAddr := app.String(cli.StringOpt{
+		Name:   "listen",
+		Value:  "",
+		Desc:   "host:port of the HTTP server exposing metrics and health, no metrics or health checks are registered when empty",
+		EnvVar: "GREMLIN_SYNC_LISTEN",
+	})
 	utils.SetupLogging(app, log)
 	app.Action = func() {
+		config, err := cassandraConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		setupTransforms()
 		gremlinURI := fmt.Sprintf("ws://%s/gremlin", *gremlinSrv)
 		rabbitURI := fmt.Sprintf("amqp://%s:%s@%s/", *rabbitUser,
 			*rabbitPassword, *rabbitSrv)
-		setup(gremlinURI, *cassandraSrvs, rabbitURI, *rabbitVHost,
-			*rabbitQueue)
+		setup(gremlinURI, config, rabbitURI, *rabbitVHost,
+			*rabbitQueue, *rabbitDLX, *workers, *bootstrap, *bootstrapWorkers, *reconcileInterval, *journalPath, *listenAddr)
 	}
 	app.Run(os.Args)
 }
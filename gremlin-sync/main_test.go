@@ -10,6 +10,7 @@ import (
 
 	"github.com/eonpatapon/contrail-gremlin/testutils"
 	"github.com/eonpatapon/gremlin"
+	dto "github.com/prometheus/client_model/go"
 	uuid "github.com/satori/go.uuid"
 	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
@@ -120,6 +121,44 @@ func TestSynchroOrdering(t *testing.T) {
 	sync.stop()
 }
 
+func TestShard(t *testing.T) {
+	nodeUUID, _ := uuid.NewV4()
+	idx := shard(nodeUUID, SyncWorkers)
+	assert.True(t, idx >= 0 && idx < SyncWorkers)
+	assert.Equal(t, idx, shard(nodeUUID, SyncWorkers))
+	assert.Equal(t, 0, shard(nodeUUID, 1))
+}
+
+func TestRunInShard(t *testing.T) {
+	nodeUUID, _ := uuid.NewV4()
+
+	msgs := make(chan amqp.Delivery)
+	sync := NewSync(&gockle.SessionMock{}, msgs, gremlinURI)
+	done := make(chan bool)
+	go func() {
+		sync.synchronize()
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	sync.shardsLock.RLock()
+	assert.Equal(t, SyncWorkers, len(sync.shards))
+	sync.shardsLock.RUnlock()
+
+	ran := false
+	sync.runInShard(nodeUUID, func() { ran = true })
+	assert.True(t, ran)
+
+	close(msgs)
+	<-done
+
+	// notifications are not dispatched anymore
+	ran = false
+	sync.runInShard(nodeUUID, func() { ran = true })
+	assert.True(t, ran)
+}
+
 func TestDelete(t *testing.T) {
 	nodeUUID, _ := uuid.NewV4()
 	resource := []map[string]interface{}{
@@ -166,3 +205,262 @@ func TestDelete(t *testing.T) {
 
 	sync.stop()
 }
+
+type fqNameIterator struct {
+	rows []string
+	idx  *int
+}
+
+func (i fqNameIterator) Close() error {
+	return nil
+}
+
+func (i fqNameIterator) Scan(results ...interface{}) bool {
+	if *i.idx >= len(i.rows) {
+		return false
+	}
+	*results[0].(*string) = i.rows[*i.idx]
+	*i.idx++
+	return true
+}
+
+func (i fqNameIterator) ScanMap(results map[string]interface{}) bool {
+	return false
+}
+
+func TestBootstrap(t *testing.T) {
+	nodeUUID, _ := uuid.NewV4()
+	updatedUUID, _ := uuid.NewV4()
+
+	query := "SELECT key, column1, value FROM obj_uuid_table WHERE key=?"
+	session := &gockle.SessionMock{}
+	session.When("Close").Return()
+	session.When("ScanIterator", "SELECT column1 FROM obj_fq_name_table", []interface{}(nil)).Return(
+		fqNameIterator{
+			rows: []string{
+				"virtual_machine:foo:" + nodeUUID.String(),
+				"virtual_machine:bar:" + updatedUUID.String(),
+			},
+			idx: new(int),
+		},
+	)
+	session.When("ScanMapSlice", query, []interface{}{nodeUUID.String()}).Return(
+		[]map[string]interface{}{
+			{"column1": []byte("type"), "value": `"virtual_machine"`},
+			{"column1": []byte("fq_name"), "value": `["foo"]`},
+		},
+		nil,
+	)
+	session.When("ScanMapSlice", query, []interface{}{updatedUUID.String()}).Return(
+		[]map[string]interface{}{
+			{"column1": []byte("type"), "value": `"virtual_machine"`},
+			{"column1": []byte("fq_name"), "value": `["bar"]`},
+		},
+		nil,
+	)
+
+	msgs := make(chan amqp.Delivery)
+
+	sync := NewSync(session, msgs, gremlinURI)
+	sync.bootstrapping.Store(true)
+	go sync.synchronize()
+	sync.start()
+
+	// notifications received during the bootstrap are delayed
+	msgs <- amqp.Delivery{
+		Body: []byte(fmt.Sprintf(`{"oper": "DELETE", "type": "virtual_machine", "uuid": "%s"}`, updatedUUID))}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, len(sync.pending))
+
+	err := sync.bootstrap(2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sync.pending))
+
+	var uuids []string
+	r, _ := sync.backend.Send(
+		gremlin.Query(`g.V(uuid).has("deleted", 0).id()`).Bindings(
+			gremlin.Bind{"uuid": nodeUUID.String()},
+		),
+	)
+	json.Unmarshal(r, &uuids)
+	assert.Equal(t, []string{nodeUUID.String()}, uuids)
+
+	uuids = []string{}
+	r, _ = sync.backend.Send(
+		gremlin.Query(`g.V(uuid).has("deleted", 0).id()`).Bindings(
+			gremlin.Bind{"uuid": updatedUUID.String()},
+		),
+	)
+	json.Unmarshal(r, &uuids)
+	assert.Equal(t, 0, len(uuids))
+
+	sync.stop()
+}
+
+func TestBootstrapFailure(t *testing.T) {
+	nodeUUID, _ := uuid.NewV4()
+
+	query := "SELECT key, column1, value FROM obj_uuid_table WHERE key=?"
+	session := &gockle.SessionMock{}
+	session.When("Close").Return()
+	session.When("ScanIterator", "SELECT column1 FROM obj_fq_name_table", []interface{}(nil)).Return(
+		fqNameIterator{
+			rows: []string{
+				"virtual_machine:foo:" + nodeUUID.String(),
+			},
+			idx: new(int),
+		},
+	)
+	session.When("ScanMapSlice", query, []interface{}{nodeUUID.String()}).Return(
+		[]map[string]interface{}(nil),
+		errors.New("Fake read error"),
+	)
+
+	msgs := make(chan amqp.Delivery)
+
+	sync := NewSync(session, msgs, gremlinURI)
+	sync.bootstrapping.Store(true)
+
+	// the graph is incomplete
+	err := sync.bootstrap(1)
+	assert.NotNil(t, err)
+}
+
+func TestReconcile(t *testing.T) {
+	nodeUUID, _ := uuid.NewV4()
+
+	query := "SELECT key, column1, value FROM obj_uuid_table WHERE key=?"
+	updatedQuery := "SELECT key, column1, value FROM obj_uuid_table WHERE key=? AND column1 IN (?, ?)"
+	session := &gockle.SessionMock{}
+	session.When("Close").Return()
+	mock := session.When("ScanMapSlice", query, []interface{}{nodeUUID.String()})
+	mock.Return(
+		[]map[string]interface{}{
+			{"column1": []byte("type"), "value": `"virtual_machine"`},
+			{"column1": []byte("fq_name"), "value": `["foo"]`},
+			{"column1": []byte("prop:id_perms"), "value": `{"last_modified": "2018-03-05T06:21:57.186987"}`},
+		},
+		nil,
+	)
+	updatedMock := session.When("ScanMapSlice", updatedQuery,
+		[]interface{}{nodeUUID.String(), []byte("type"), []byte("prop:id_perms")})
+	updatedMock.Return(
+		[]map[string]interface{}{
+			{"column1": []byte("type"), "value": `"virtual_machine"`},
+			{"column1": []byte("prop:id_perms"), "value": `{"last_modified": "2018-03-05T06:21:57.186987"}`},
+		},
+		nil,
+	)
+
+	msgs := make(chan amqp.Delivery)
+
+	sync := NewSync(session, msgs, gremlinURI)
+	sync.start()
+
+	r := NewReconciler(sync, time.Minute)
+
+	// the resource is missing in the graph
+	states, err := r.graphStates()
+	assert.Nil(t, err)
+	// but it was not modified during the outage
+	r.reconcileResource(nodeUUID, states, time.Now())
+	assert.Nil(t, r.drifts["virtual_machine"])
+	r.reconcileResource(nodeUUID, states, time.Time{})
+	assert.Equal(t, 1, r.drifts["virtual_machine"].Missing)
+
+	// the resource was updated in the DB
+	mock.ReturnValues = []interface{}{}
+	mock.Return(
+		[]map[string]interface{}{
+			{"column1": []byte("type"), "value": `"virtual_machine"`},
+			{"column1": []byte("fq_name"), "value": `["foo"]`},
+			{"column1": []byte("prop:id_perms"), "value": `{"last_modified": "2018-03-06T06:21:57.186987"}`},
+		},
+		nil,
+	)
+	updatedMock.ReturnValues = []interface{}{}
+	updatedMock.Return(
+		[]map[string]interface{}{
+			{"column1": []byte("type"), "value": `"virtual_machine"`},
+			{"column1": []byte("prop:id_perms"), "value": `{"last_modified": "2018-03-06T06:21:57.186987"}`},
+		},
+		nil,
+	)
+	states, _ = r.graphStates()
+	r.reconcileResource(nodeUUID, states, time.Time{})
+	assert.Equal(t, 1, r.drifts["virtual_machine"].Outdated)
+
+	var updated []int64
+	res, _ := sync.backend.Send(
+		gremlin.Query(`g.V(uuid).values('updated')`).Bindings(
+			gremlin.Bind{"uuid": nodeUUID.String()},
+		),
+	)
+	json.Unmarshal(res, &updated)
+	assert.Equal(t, []int64{1520317317}, updated)
+
+	// the resource is in sync
+	states, _ = r.graphStates()
+	r.reconcileResource(nodeUUID, states, time.Time{})
+	assert.Equal(t, 1, r.drifts["virtual_machine"].Outdated)
+
+	// the resource was removed from the DB
+	mock.ReturnValues = []interface{}{}
+	mock.Return([]map[string]interface{}{}, nil)
+	updatedMock.ReturnValues = []interface{}{}
+	updatedMock.Return([]map[string]interface{}{}, nil)
+	states, _ = r.graphStates()
+	r.reconcileStale(states[nodeUUID])
+	assert.Equal(t, 1, r.drifts["virtual_machine"].Stale)
+
+	var uuids []string
+	res, _ = sync.backend.Send(
+		gremlin.Query(`g.V(uuid).id()`).Bindings(
+			gremlin.Bind{"uuid": nodeUUID.String()},
+		),
+	)
+	json.Unmarshal(res, &uuids)
+	assert.Equal(t, 0, len(uuids))
+
+	sync.stop()
+}
+
+func TestReconcileOutageMerge(t *testing.T) {
+	sync := NewSync(&gockle.SessionMock{}, make(chan amqp.Delivery), gremlinURI)
+	r := NewReconciler(sync, time.Minute)
+
+	// an outage reconciliation just ran, the next one is delayed
+	r.lastOutage = time.Now()
+	first := time.Now().Add(-10 * time.Minute)
+	r.reconcileOutage(first)
+	r.reconcileOutage(first.Add(5 * time.Minute))
+	r.reconcileOutage(first.Add(-5 * time.Minute))
+
+	r.Lock()
+	assert.True(t, r.outageScheduled)
+	assert.Equal(t, first.Add(-5*time.Minute), r.outageSince)
+	r.Unlock()
+
+	r.stop()
+}
+
+func TestReportDrifts(t *testing.T) {
+	sync := NewSync(&gockle.SessionMock{}, make(chan amqp.Delivery), gremlinURI)
+	r := NewReconciler(sync, time.Minute)
+
+	drift := func(resType string, kind string) float64 {
+		var m dto.Metric
+		reconcileDrift.WithLabelValues("periodic", resType, kind).Write(&m)
+		return m.GetGauge().GetValue()
+	}
+
+	r.reportDrifts(time.Time{}, map[string]Drift{"foo": {Outdated: 2, Stale: 1}})
+	assert.Equal(t, float64(2), drift("foo", "outdated"))
+	assert.Equal(t, float64(1), drift("foo", "stale"))
+
+	// foo is in sync at the next reconciliation
+	r.reportDrifts(time.Time{}, map[string]Drift{"bar": {Missing: 3}})
+	assert.Equal(t, float64(0), drift("foo", "outdated"))
+	assert.Equal(t, float64(3), drift("bar", "missing"))
+}
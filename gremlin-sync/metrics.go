@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satori/go.uuid"
+)
+
+const metricsNamespace = "gremlin_sync"
+
+var (
+	notificationsReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notifications_received_total",
+			Help:      "Number of notifications received from rabbitmq.",
+		},
+		[]string{"oper", "type"},
+	)
+	notificationsProcessed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notifications_processed_total",
+			Help:      "Number of notifications applied in the graph.",
+		},
+		[]string{"oper", "type"},
+	)
+	notificationsFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "notifications_failed_total",
+			Help:      "Number of notifications that could not be applied in the graph.",
+		},
+		[]string{"oper", "type"},
+	)
+	pendingNotifications = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "pending_notifications",
+			Help:      "Number of notifications in the pending list.",
+		},
+	)
+	cassandraReadDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "cassandra_read_duration_seconds",
+			Help:      "Duration of resource reads in cassandra.",
+		},
+	)
+	gremlinQueryDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "gremlin_query_duration_seconds",
+			Help:      "Duration of gremlin server requests.",
+		},
+	)
+	gremlinQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "gremlin_queries_total",
+			Help:      "Number of gremlin server requests by result (success or error).",
+		},
+		[]string{"result"},
+	)
+	reconcileDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconcile_drift_resources",
+			Help:      "Number of resources that differed between cassandra and the graph at the last reconciliation, by reconciliation (periodic or outage), type and drift (outdated, missing or stale).",
+		},
+		[]string{"reconciliation", "type", "drift"},
+	)
+	deleteChecks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "delete_checks_total",
+			Help:      "Number of deletion checks by result (deleted or present).",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		notificationsReceived,
+		notificationsProcessed,
+		notificationsFailed,
+		pendingNotifications,
+		cassandraReadDuration,
+		gremlinQueryDuration,
+		gremlinQueries,
+		reconcileDrift,
+		deleteChecks,
+	)
+}
+
+// registerMetrics registers the metrics reading
+// the state of the sync process
+func registerMetrics(s *Sync) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "gremlin_connected",
+				Help:      "1 when connected to gremlin server, 0 otherwise.",
+			},
+			func() float64 {
+				if s.backend.Connected() {
+					return 1
+				}
+				return 0
+			},
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "notifications_retried_total",
+				Help:      "Number of retries of notifications after a transient error.",
+			},
+			func() float64 {
+				return float64(atomic.LoadInt64(&s.stats.Retried))
+			},
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "notifications_dead_lettered_total",
+				Help:      "Number of notifications rejected to the dead-letter exchange.",
+			},
+			func() float64 {
+				return float64(atomic.LoadInt64(&s.stats.DeadLettered))
+			},
+		),
+	)
+}
+
+func observeGremlinQuery(d time.Duration, err error) {
+	gremlinQueryDuration.Observe(d.Seconds())
+	if err != nil {
+		gremlinQueries.WithLabelValues("error").Inc()
+	} else {
+		gremlinQueries.WithLabelValues("success").Inc()
+	}
+}
+
+// getContrailResource reads the resource in cassandra
+// and records the duration of the read
+func (s *Sync) getContrailResource(id uuid.UUID) (g.Vertex, error) {
+	start := time.Now()
+	vertex, err := utils.GetContrailResource(s.session, id)
+	cassandraReadDuration.Observe(time.Since(start).Seconds())
+	return vertex, err
+}
+
+// getContrailResourceUpdated reads the type and id_perms of the
+// resource in cassandra and records the duration of the read
+func (s *Sync) getContrailResourceUpdated(id uuid.UUID) (g.Vertex, error) {
+	start := time.Now()
+	vertex, err := utils.GetContrailResourceUpdated(s.session, id)
+	cassandraReadDuration.Observe(time.Since(start).Seconds())
+	return vertex, err
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/contrail-gremlin/utils"
+	"github.com/eonpatapon/gremlin"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// ReconcileWorkers is the number of workers reading
+	// cassandra resources during a reconciliation
+	ReconcileWorkers = 4
+	// ReconcileOutageMargin is added before the start of an outage
+	// to cover clock differences with the contrail-api nodes
+	ReconcileOutageMargin = 1 * time.Minute
+)
+
+var (
+	// ReconcileOutageInterval is the minimum time between two outage
+	// reconciliations. Outages that end meanwhile are reconciled
+	// together by the next one.
+	ReconcileOutageInterval = 5 * time.Minute
+)
+
+// graphState is the state of a vertex in the graph
+type graphState struct {
+	ID      uuid.UUID `json:"id"`
+	Label   string    `json:"label"`
+	Updated int64     `json:"updated"`
+	Missing bool      `json:"missing"`
+	Deleted int64     `json:"deleted"`
+}
+
+// Drift counts the differences found between the
+// contrail DB and the graph for a resource type
+type Drift struct {
+	// Outdated resources have a different updated timestamp
+	Outdated int
+	// Missing resources are in the DB but not in the graph
+	Missing int
+	// Stale resources are in the graph but not in the DB
+	Stale int
+}
+
+// Reconciler periodically compares the contrail DB with the graph
+// and fixes vertices that have diverged because of lost notifications.
+type Reconciler struct {
+	s        *Sync
+	interval time.Duration
+	quit     chan bool
+	wg       *sync.WaitGroup
+	drifts   map[string]*Drift
+	// resource types reported in the drift metrics
+	// by periodic and outage reconciliations
+	driftTypes map[string]map[string]bool
+	// outage reconciliation waiting for ReconcileOutageInterval
+	outageScheduled bool
+	outageSince     time.Time
+	lastOutage      time.Time
+	// only one reconciliation runs at a time
+	running sync.Mutex
+	sync.Mutex
+}
+
+// NewReconciler returns a reconciler that runs every interval
+func NewReconciler(s *Sync, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		s:        s,
+		interval: interval,
+		quit:     make(chan bool),
+		wg:       &sync.WaitGroup{},
+		drifts:   make(map[string]*Drift),
+		driftTypes: map[string]map[string]bool{
+			"periodic": make(map[string]bool),
+			"outage":   make(map[string]bool),
+		},
+	}
+}
+
+func (r *Reconciler) start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !r.s.backend.Connected() || r.s.bootstrapping.Load() == true {
+					log.Warning("Skipping reconciliation, graph is not ready")
+					continue
+				}
+				if _, err := r.reconcile(); err != nil {
+					log.Errorf("Reconciliation failed: %s", err)
+				}
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+}
+
+// reconcileOutage reconciles the resources modified since
+// the notifications stopped being received.
+//
+// Contrail DB can't list the resources modified after a date, so
+// the id_perms of all resources are read like in a periodic
+// reconciliation, only the resources modified during the outage
+// are synced again. Outage reconciliations are run at most once
+// every ReconcileOutageInterval: outages that end meanwhile are
+// merged in the next reconciliation.
+func (r *Reconciler) reconcileOutage(since time.Time) {
+	r.Lock()
+	if r.outageScheduled {
+		if since.Before(r.outageSince) {
+			r.outageSince = since
+		}
+		r.Unlock()
+		return
+	}
+	r.outageScheduled = true
+	r.outageSince = since
+	wait := r.lastOutage.Add(ReconcileOutageInterval).Sub(time.Now())
+	r.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if wait > 0 {
+			log.Noticef("Delaying outage reconciliation by %s", wait)
+			select {
+			case <-time.After(wait):
+			case <-r.quit:
+				return
+			}
+		}
+		r.Lock()
+		since := r.outageSince
+		r.outageScheduled = false
+		r.lastOutage = time.Now()
+		r.Unlock()
+		if !r.s.backend.Connected() || r.s.bootstrapping.Load() == true {
+			log.Warning("Skipping outage reconciliation, graph is not ready")
+			return
+		}
+		log.Noticef("Reconciling resources modified since %s", since)
+		if _, err := r.reconcileSince(since.Add(-ReconcileOutageMargin)); err != nil {
+			log.Errorf("Outage reconciliation failed: %s", err)
+		}
+	}()
+}
+
+func (r *Reconciler) stop() {
+	close(r.quit)
+	r.wg.Wait()
+}
+
+func (r *Reconciler) graphStates() (map[uuid.UUID]graphState, error) {
+	data, err := r.s.backend.Send(
+		gremlin.Query(`g.V().project('id', 'label', 'updated', 'missing', 'deleted')
+			.by(id)
+			.by(label)
+			.by(coalesce(values('updated'), constant(-1)))
+			.by(coalesce(values('_missing'), constant(false)))
+			.by(coalesce(values('deleted'), constant(0)))`),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var states []graphState
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &states); err != nil {
+			return nil, err
+		}
+	}
+	statesByID := make(map[uuid.UUID]graphState, len(states))
+	for _, state := range states {
+		statesByID[state.ID] = state
+	}
+	return statesByID, nil
+}
+
+func (r *Reconciler) addDrift(resType string, f func(*Drift)) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.drifts[resType]; !ok {
+		r.drifts[resType] = &Drift{}
+	}
+	f(r.drifts[resType])
+}
+
+// reconcile runs a reconciliation and returns the drift
+// found for each resource type
+func (r *Reconciler) reconcile() (map[string]Drift, error) {
+	return r.reconcileSince(time.Time{})
+}
+
+// reconcileSince runs a reconciliation of the resources modified
+// after since. Stale vertices are removed regardless of since
+// because deleted resources are not in the DB anymore.
+func (r *Reconciler) reconcileSince(since time.Time) (map[string]Drift, error) {
+	r.running.Lock()
+	defer r.running.Unlock()
+
+	log.Notice("Reconciling graph with Cassandra...")
+	start := time.Now()
+	r.drifts = make(map[string]*Drift)
+
+	states, err := r.graphStates()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		uuids = make(chan uuid.UUID)
+		seen  = make(map[uuid.UUID]bool, len(states))
+		wg    = &sync.WaitGroup{}
+	)
+	for w := 1; w <= ReconcileWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for uuid := range uuids {
+				r.Lock()
+				seen[uuid] = true
+				r.Unlock()
+				r.reconcileResource(uuid, states, since)
+			}
+		}()
+	}
+
+	err = utils.GetContrailUUIDs(r.s.session, uuids)
+	close(uuids)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	for id, state := range states {
+		// deleted resources are handled by the sync process
+		if seen[id] || state.Missing || state.Deleted > 0 {
+			continue
+		}
+		r.reconcileStale(state)
+	}
+
+	drifts := make(map[string]Drift, len(r.drifts))
+	resTypes := make([]string, 0, len(r.drifts))
+	for resType, drift := range r.drifts {
+		drifts[resType] = *drift
+		resTypes = append(resTypes, resType)
+	}
+	sort.Strings(resTypes)
+	for _, resType := range resTypes {
+		drift := drifts[resType]
+		log.Warningf("Drift for %s [outdated:%d missing:%d stale:%d]",
+			resType, drift.Outdated, drift.Missing, drift.Stale)
+	}
+	r.reportDrifts(since, drifts)
+	log.Noticef("Reconciliation done in %0.2fs", time.Now().Sub(start).Seconds())
+
+	return drifts, nil
+}
+
+// reportDrifts sets the drift metrics of the reconciliation. The
+// drift of the resource types found by previous reconciliations of
+// the same kind is reset.
+func (r *Reconciler) reportDrifts(since time.Time, drifts map[string]Drift) {
+	reconciliation := "periodic"
+	if !since.IsZero() {
+		reconciliation = "outage"
+	}
+	r.Lock()
+	defer r.Unlock()
+	for resType := range drifts {
+		r.driftTypes[reconciliation][resType] = true
+	}
+	for resType := range r.driftTypes[reconciliation] {
+		drift := drifts[resType]
+		reconcileDrift.WithLabelValues(reconciliation, resType, "outdated").Set(float64(drift.Outdated))
+		reconcileDrift.WithLabelValues(reconciliation, resType, "missing").Set(float64(drift.Missing))
+		reconcileDrift.WithLabelValues(reconciliation, resType, "stale").Set(float64(drift.Stale))
+	}
+}
+
+// reconcileResource syncs the resource id again when its updated
+// timestamp is different in the graph. Only the type and id_perms
+// columns are read to compare the timestamps, the whole resource is
+// read and written by the worker handling the notifications of the
+// resource so that the writes are ordered with the notifications.
+func (r *Reconciler) reconcileResource(id uuid.UUID, states map[uuid.UUID]graphState, since time.Time) {
+	vertex, err := r.s.getContrailResourceUpdated(id)
+	switch err {
+	case nil:
+	// the resource was deleted since the uuid was listed
+	case utils.ErrResourceNotFound:
+		return
+	default:
+		log.Errorf("Failed to retrieve resource %s from db: %s", id, err)
+		return
+	}
+
+	updated, err := vertex.Int64("updated")
+	if err != nil {
+		updated = -1
+	}
+
+	// the resource was not modified during the outage
+	if !since.IsZero() && updated < since.Unix() {
+		return
+	}
+
+	state, ok := states[id]
+	switch {
+	case !ok || state.Missing:
+		r.addDrift(vertex.Label, func(d *Drift) { d.Missing++ })
+	// the resource is being deleted
+	case state.Deleted > 0:
+		return
+	case state.Updated != updated:
+		r.addDrift(vertex.Label, func(d *Drift) { d.Outdated++ })
+	default:
+		return
+	}
+
+	r.s.runInShard(id, func() {
+		vertex, err := r.s.getContrailResource(id)
+		switch err {
+		case nil:
+		case utils.ErrResourceNotFound:
+			return
+		default:
+			log.Errorf("Failed to retrieve resource %s from db: %s", id, err)
+			return
+		}
+		log.Debugf("[RECONCILE] %s/%s", vertex.Label, id)
+		if err := r.s.backend.UpdateVertex(vertex); err != nil {
+			log.Errorf("Failed to update %s/%s: %s", vertex.Label, id, err)
+		}
+	})
+}
+
+func (r *Reconciler) reconcileStale(state graphState) {
+	r.s.runInShard(state.ID, func() {
+		// Make sure the resource was not created after
+		// the list of resources was retrieved
+		_, err := r.s.getContrailResourceUpdated(state.ID)
+		if err != utils.ErrResourceNotFound {
+			return
+		}
+		r.addDrift(state.Label, func(d *Drift) { d.Stale++ })
+		log.Debugf("[RECONCILE] %s/%s [-]", state.Label, state.ID)
+		if err := r.s.backend.DeleteVertex(g.Vertex{ID: state.ID}); err != nil {
+			log.Errorf("Failed to delete %s/%s: %s", state.Label, state.ID, err)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/eonpatapon/gremlin"
+	"github.com/gocql/gocql"
+	"github.com/streadway/amqp"
+)
+
+var (
+	// MaxRetries is the number of times a notification is
+	// retried when a transient error occurs
+	MaxRetries = 5
+	// RetryInterval is the time to wait before the first retry,
+	// it is doubled after each retry
+	RetryInterval = 200 * time.Millisecond
+)
+
+// SyncStats counts the notifications that needed special handling
+type SyncStats struct {
+	// Retried is the number of retries of notifications
+	Retried int64
+	// DeadLettered is the number of notifications rejected
+	// to the dead-letter exchange
+	DeadLettered int64
+}
+
+// isTransientError returns true when the error may not
+// happen if the notification is handled again later
+func isTransientError(err error) bool {
+	switch err {
+	case gocql.ErrTimeoutNoResponse, gocql.ErrTooManyTimeouts,
+		gocql.ErrConnectionClosed, gocql.ErrNoStreams,
+		gocql.ErrNoConnections, gocql.ErrUnavailable,
+		gremlin.ErrConnectionClosed, gremlin.ErrStatusServerTimeout:
+		return true
+	}
+	switch err.(type) {
+	case *gocql.RequestErrUnavailable, *gocql.RequestErrReadTimeout,
+		*gocql.RequestErrWriteTimeout:
+		return true
+	}
+	return false
+}
+
+// handleNotificationWithRetry handles the notification
+// and retries with a backoff on transient errors
+func (s *Sync) handleNotificationWithRetry(n Notification) error {
+	interval := RetryInterval
+	for retry := 0; ; retry++ {
+		err := s.handleNotification(n)
+		// On connection loss the notification is
+		// added to the pending list
+		if err == nil || err == gremlin.ErrConnectionClosed ||
+			!isTransientError(err) || retry == MaxRetries {
+			return err
+		}
+		atomic.AddInt64(&s.stats.Retried, 1)
+		log.Warningf("[%s] %s/%s retrying in %s", n.Oper, n.Type, n.UUID, interval)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+// deadLetter rejects the delivery so that it is routed
+// to the dead-letter exchange of the queue if any
+func (s *Sync) deadLetter(d amqp.Delivery, err error) {
+	atomic.AddInt64(&s.stats.DeadLettered, 1)
+	log.Errorf("Rejecting notification %s: %s [dead-lettered:%d]",
+		string(d.Body), err, atomic.LoadInt64(&s.stats.DeadLettered))
+	d.Nack(false, false)
+}
+
+// Stats returns the current stats of the sync process
+func (s *Sync) Stats() SyncStats {
+	return SyncStats{
+		Retried:      atomic.LoadInt64(&s.stats.Retried),
+		DeadLettered: atomic.LoadInt64(&s.stats.DeadLettered),
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/eonpatapon/gremlin"
+	"github.com/gocql/gocql"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/willfaught/gockle"
+)
+
+type fakeAcknowledger struct {
+	acks  chan bool
+	nacks chan bool
+}
+
+func (a fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acks <- true
+	return nil
+}
+
+func (a fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacks <- requeue
+	return nil
+}
+
+func (a fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.nacks <- requeue
+	return nil
+}
+
+func TestTransientError(t *testing.T) {
+	assert.True(t, isTransientError(gocql.ErrTimeoutNoResponse))
+	assert.True(t, isTransientError(&gocql.RequestErrReadTimeout{}))
+	assert.True(t, isTransientError(gremlin.ErrConnectionClosed))
+	assert.False(t, isTransientError(g.ErrIncompleteVertex))
+	assert.False(t, isTransientError(errors.New("foo")))
+}
+
+func TestDeadLetter(t *testing.T) {
+	session := &gockle.SessionMock{}
+	msgs := make(chan amqp.Delivery)
+	ack := fakeAcknowledger{
+		acks:  make(chan bool, 1),
+		nacks: make(chan bool, 1),
+	}
+
+	sync := NewSync(session, msgs, gremlinURI)
+	go sync.synchronize()
+
+	msgs <- amqp.Delivery{
+		Acknowledger: ack,
+		Body:         []byte(`{"oper": "CREATE", "uuid": "foo"}`),
+	}
+
+	select {
+	case requeue := <-ack.nacks:
+		assert.False(t, requeue)
+	case <-ack.acks:
+		t.Error("Invalid notification acked")
+	case <-time.After(time.Second):
+		t.Error("Invalid notification not rejected")
+	}
+	assert.Equal(t, int64(1), sync.Stats().DeadLettered)
+
+	close(msgs)
+}
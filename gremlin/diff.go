@@ -0,0 +1,201 @@
+package gremlin
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/satori/go.uuid"
+)
+
+// EdgeKey identifies the edges with the same label
+// between the same vertices
+type EdgeKey struct {
+	OutV  uuid.UUID
+	InV   uuid.UUID
+	Label string
+}
+
+// Key returns the EdgeKey of the edge
+func (e Edge) Key() EdgeKey {
+	return EdgeKey{
+		OutV:  e.OutV,
+		InV:   e.InV,
+		Label: e.Label,
+	}
+}
+
+// EdgeDiff is the set of changes needed to go from
+// a list of current edges to a list of wanted edges
+type EdgeDiff struct {
+	Add    []Edge
+	Update []Edge
+	// Replaced are the current edges changed by Update,
+	// Replaced[i] gets the properties of Update[i]
+	Replaced []Edge
+	Remove   []Edge
+}
+
+// NewEdgeDiff compares current and wanted edges by EdgeKey.
+//
+// When several edges share the same key, wanted edges are first
+// matched with current edges that have the same properties. Remaining
+// edges are matched in order and reported as updates.
+func NewEdgeDiff(current []Edge, wanted []Edge) EdgeDiff {
+	var d EdgeDiff
+
+	index := make(map[EdgeKey][]Edge, len(current))
+	for _, e := range current {
+		index[e.Key()] = append(index[e.Key()], e)
+	}
+
+	unmatched := make(map[EdgeKey][]Edge, 0)
+	var keys []EdgeKey
+	for _, e := range wanted {
+		key := e.Key()
+		candidates := index[key]
+		found := false
+		for i, c := range candidates {
+			if edgePropertiesEqual(c.Properties, e.Properties) {
+				index[key] = append(candidates[:i], candidates[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			if _, ok := unmatched[key]; !ok {
+				keys = append(keys, key)
+			}
+			unmatched[key] = append(unmatched[key], e)
+		}
+	}
+
+	for _, key := range keys {
+		for _, e := range unmatched[key] {
+			if len(index[key]) > 0 {
+				d.Replaced = append(d.Replaced, index[key][0])
+				index[key] = index[key][1:]
+				d.Update = append(d.Update, e)
+			} else {
+				d.Add = append(d.Add, e)
+			}
+		}
+	}
+
+	// Keep the order of the current edges
+	for _, e := range current {
+		key := e.Key()
+		if len(index[key]) > 0 {
+			d.Remove = append(d.Remove, index[key][0])
+			index[key] = index[key][1:]
+		}
+	}
+
+	return d
+}
+
+// KeepInEdges removes the updates of the in-edges of the vertex id.
+// The properties of an in-edge belong to the other vertex, the
+// current edge is kept as is.
+func (d EdgeDiff) KeepInEdges(id uuid.UUID) EdgeDiff {
+	var (
+		update   []Edge
+		replaced []Edge
+	)
+	for i, e := range d.Update {
+		if e.OutV != id {
+			continue
+		}
+		update = append(update, e)
+		replaced = append(replaced, d.Replaced[i])
+	}
+	d.Update = update
+	d.Replaced = replaced
+	return d
+}
+
+// Empty returns true if there is no change in the diff
+func (d EdgeDiff) Empty() bool {
+	return len(d.Add) == 0 && len(d.Update) == 0 && len(d.Remove) == 0
+}
+
+// edgePropertiesEqual compares edge properties ignoring
+// null values since they are never stored on edges
+func edgePropertiesEqual(p1 map[string]Property, p2 map[string]Property) bool {
+	return cmp.Equal(nonNullProperties(p1), nonNullProperties(p2))
+}
+
+func nonNullProperties(props map[string]Property) map[string]interface{} {
+	values := make(map[string]interface{}, len(props))
+	for name, prop := range props {
+		if prop.Value != nil {
+			values[name] = prop.Value
+		}
+	}
+	return values
+}
+
+// PropertyDiff is the change of a vertex property,
+// Old or New is nil when the property was added or removed
+type PropertyDiff struct {
+	Old []interface{} `json:"old,omitempty"`
+	New []interface{} `json:"new,omitempty"`
+}
+
+// VertexDiff is the set of changes between two versions of a vertex
+type VertexDiff struct {
+	ID         uuid.UUID               `json:"id"`
+	Label      string                  `json:"label"`
+	OldLabel   string                  `json:"old_label,omitempty"`
+	Properties map[string]PropertyDiff `json:"properties,omitempty"`
+	AddEdges   []Edge                  `json:"add_edges,omitempty"`
+	// edges with the same key but different properties
+	UpdateEdges []Edge `json:"update_edges,omitempty"`
+	RemoveEdges []Edge `json:"remove_edges,omitempty"`
+}
+
+// NewVertexDiff compares the properties and the edges of two
+// versions of a vertex. Out edges are compared with NewEdgeDiff,
+// in edges are compared with the other vertex so that each edge
+// is only reported once.
+func NewVertexDiff(from Vertex, to Vertex) VertexDiff {
+	d := VertexDiff{
+		ID:         to.ID,
+		Label:      to.Label,
+		Properties: make(map[string]PropertyDiff),
+	}
+	if from.Label != to.Label {
+		d.OldLabel = from.Label
+	}
+	for name, props := range from.Properties {
+		oldValues := propertyValues(props)
+		newValues := propertyValues(to.Properties[name])
+		if !cmp.Equal(oldValues, newValues) {
+			d.Properties[name] = PropertyDiff{Old: oldValues, New: newValues}
+		}
+	}
+	for name, props := range to.Properties {
+		if _, ok := from.Properties[name]; !ok {
+			d.Properties[name] = PropertyDiff{New: propertyValues(props)}
+		}
+	}
+	ed := NewEdgeDiff(from.OutEdges(), to.OutEdges())
+	d.AddEdges = ed.Add
+	d.UpdateEdges = ed.Update
+	d.RemoveEdges = ed.Remove
+	return d
+}
+
+// Empty returns true if both versions of the vertex are the same
+func (d VertexDiff) Empty() bool {
+	return d.OldLabel == "" && len(d.Properties) == 0 &&
+		len(d.AddEdges) == 0 && len(d.UpdateEdges) == 0 && len(d.RemoveEdges) == 0
+}
+
+func propertyValues(props []Property) []interface{} {
+	if len(props) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(props))
+	for i, prop := range props {
+		values[i] = prop.Value
+	}
+	return values
+}
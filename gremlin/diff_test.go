@@ -0,0 +1,136 @@
+package gremlin
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgeDiffKeys(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+
+	current := []Edge{
+		Edge{OutV: id1, InV: id2, Label: "ref"},
+		Edge{OutV: id1, InV: id3, Label: "parent"},
+	}
+	e1 := Edge{OutV: id1, InV: id2, Label: "ref"}
+	e1.AddProperty("foo", "bar")
+	wanted := []Edge{
+		e1,
+		Edge{OutV: id3, InV: id1, Label: "ref"},
+	}
+
+	d := NewEdgeDiff(current, wanted)
+	assert.Equal(t, []Edge{wanted[1]}, d.Add)
+	assert.Equal(t, []Edge{e1}, d.Update)
+	assert.Equal(t, []Edge{current[1]}, d.Remove)
+
+	d = NewEdgeDiff(wanted, wanted)
+	assert.True(t, d.Empty())
+}
+
+func TestEdgeDiffMultipleEdges(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+
+	e1 := Edge{OutV: id1, InV: id2, Label: "ref"}
+	e1.AddProperty("prop", 1)
+	e2 := Edge{OutV: id1, InV: id2, Label: "ref"}
+	e2.AddProperty("prop", 2)
+	e3 := Edge{OutV: id1, InV: id2, Label: "ref"}
+	e3.AddProperty("prop", 3)
+
+	d := NewEdgeDiff([]Edge{e1, e2}, []Edge{e2, e1})
+	assert.True(t, d.Empty())
+
+	d = NewEdgeDiff([]Edge{e1, e2}, []Edge{e2, e3})
+	assert.Equal(t, 0, len(d.Add))
+	assert.Equal(t, []Edge{e3}, d.Update)
+	assert.Equal(t, []Edge{e1}, d.Replaced)
+	assert.Equal(t, 0, len(d.Remove))
+
+	d = NewEdgeDiff([]Edge{e1, e2}, []Edge{e2})
+	assert.Equal(t, 0, len(d.Add))
+	assert.Equal(t, 0, len(d.Update))
+	assert.Equal(t, []Edge{e1}, d.Remove)
+
+	d = NewEdgeDiff([]Edge{e1}, []Edge{e1, e2, e3})
+	assert.Equal(t, []Edge{e2, e3}, d.Add)
+	assert.Equal(t, 0, len(d.Update))
+	assert.Equal(t, 0, len(d.Remove))
+}
+
+func TestEdgeDiffNullProperty(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+
+	e1 := Edge{OutV: id1, InV: id2, Label: "ref"}
+	e2 := Edge{OutV: id1, InV: id2, Label: "ref"}
+	e2.AddProperty("prop", nil)
+
+	d := NewEdgeDiff([]Edge{e1}, []Edge{e2})
+	assert.True(t, d.Empty())
+}
+
+func TestEdgeDiffKeepInEdges(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+
+	in := Edge{OutV: id2, InV: id1, Label: "ref"}
+	in.AddProperty("attr", "foo")
+	out := Edge{OutV: id1, InV: id3, Label: "ref"}
+	out.AddProperty("attr", "foo")
+	current := []Edge{in, out}
+
+	wanted := []Edge{
+		Edge{OutV: id2, InV: id1, Label: "ref"},
+		Edge{OutV: id1, InV: id3, Label: "ref"},
+	}
+	d := NewEdgeDiff(current, wanted).KeepInEdges(id1)
+	assert.Equal(t, []Edge{wanted[1]}, d.Update)
+	assert.Equal(t, []Edge{out}, d.Replaced)
+	assert.Equal(t, 0, len(d.Add))
+	assert.Equal(t, 0, len(d.Remove))
+}
+
+func TestVertexDiff(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+
+	v1 := Vertex{ID: id1, Label: "foo"}
+	v1.AddProperty("prop1", "bar")
+	v1.AddProperty("prop2", map[string]interface{}{"a": int64(1)})
+	v1.AddProperty("prop3", true)
+	v1.AddOutEdge(Edge{OutV: id1, InV: id2, Label: "ref"})
+
+	v2 := Vertex{ID: id1, Label: "foo"}
+	v2.AddProperty("prop1", "bar")
+	v2.AddProperty("prop2", map[string]interface{}{"a": int64(2)})
+	v2.AddProperty("prop4", "baz")
+	v2.AddOutEdge(Edge{OutV: id1, InV: id3, Label: "ref"})
+
+	d := NewVertexDiff(v1, v2)
+	assert.False(t, d.Empty())
+	assert.Equal(t, map[string]PropertyDiff{
+		"prop2": {
+			Old: []interface{}{map[string]interface{}{"a": int64(1)}},
+			New: []interface{}{map[string]interface{}{"a": int64(2)}},
+		},
+		"prop3": {Old: []interface{}{true}},
+		"prop4": {New: []interface{}{"baz"}},
+	}, d.Properties)
+	assert.Equal(t, []Edge{{OutV: id1, InV: id3, Label: "ref"}}, d.AddEdges)
+	assert.Equal(t, []Edge{{OutV: id1, InV: id2, Label: "ref"}}, d.RemoveEdges)
+
+	assert.True(t, NewVertexDiff(v1, v1).Empty())
+
+	// in edges are reported by the other vertex
+	v3 := Vertex{ID: id2, Label: "bar"}
+	v3.AddInEdge(Edge{OutV: id1, InV: id2, Label: "ref"})
+	assert.True(t, NewVertexDiff(v3, Vertex{ID: id2, Label: "bar"}).Empty())
+}
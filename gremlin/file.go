@@ -0,0 +1,500 @@
+package gremlin
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionNone writes plain GraphSON
+	CompressionNone = "none"
+	// CompressionGzip writes gzip compressed GraphSON
+	CompressionGzip = "gzip"
+	// CompressionZstd writes zstd compressed GraphSON
+	CompressionZstd = "zstd"
+	// ManifestSuffix is the suffix of the manifest of a chunked dump
+	ManifestSuffix = ".manifest.json"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CompressionFromPath returns the compression matching
+// the extension of path
+func CompressionFromPath(path string) string {
+	switch filepath.Ext(path) {
+	case ".gz":
+		return CompressionGzip
+	case ".zst":
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// GsonChunk is a file of a chunked dump
+type GsonChunk struct {
+	// Path is relative to the manifest
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// GsonManifest lists the chunks of a dump
+type GsonManifest struct {
+	Compression string      `json:"compression"`
+	Chunks      []GsonChunk `json:"chunks"`
+}
+
+// GsonFileState is the position of a GsonFile saved
+// by Checkpoint
+type GsonFileState struct {
+	// Chunks are the closed chunks
+	Chunks []GsonChunk `json:"chunks"`
+	// Open is true when a file is being written
+	Open bool `json:"open"`
+	// Offset is the size of the file being written
+	Offset int64 `json:"offset"`
+	// Written is the uncompressed size of the chunk being written
+	Written int64 `json:"written"`
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// GsonFile writes a dump to a file, optionally compressed and
+// split in chunks.
+//
+// A chunk is closed once it holds chunkSize bytes of GraphSON at
+// the end of a line, so each chunk is a valid GraphSON file. Chunks
+// are listed with their checksum in a manifest written on Close.
+type GsonFile struct {
+	path        string
+	compression string
+	chunkSize   int64
+	manifest    GsonManifest
+	file        *os.File
+	hash        hash.Hash
+	count       *countWriter
+	writer      io.WriteCloser
+	written     int64
+}
+
+// CreateGsonFile returns a writer of a dump at path. With a
+// chunkSize of 0 the dump is written in a single file.
+func CreateGsonFile(path string, compression string, chunkSize int64) (*GsonFile, error) {
+	switch compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return nil, fmt.Errorf("unknown compression %s", compression)
+	}
+	f := &GsonFile{
+		path:        path,
+		compression: compression,
+		chunkSize:   chunkSize,
+		manifest: GsonManifest{
+			Compression: compression,
+			Chunks:      []GsonChunk{},
+		},
+	}
+	// make sure that the destination is writable
+	if err := f.openChunk(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// chunkPath inserts the chunk index before the extensions of path:
+// dump.json.gz gives dump.0001.json.gz
+func chunkPath(path string, index int) string {
+	dir, base := filepath.Split(path)
+	parts := strings.SplitN(base, ".", 2)
+	name := fmt.Sprintf("%s.%04d", parts[0], index)
+	if len(parts) > 1 {
+		name += "." + parts[1]
+	}
+	return filepath.Join(dir, name)
+}
+
+// ManifestPath returns the path of the manifest of a chunked dump
+func ManifestPath(path string) string {
+	dir, base := filepath.Split(path)
+	return filepath.Join(dir, strings.SplitN(base, ".", 2)[0]+ManifestSuffix)
+}
+
+func (f *GsonFile) currentPath() string {
+	if f.chunkSize == 0 {
+		return f.path
+	}
+	return chunkPath(f.path, len(f.manifest.Chunks)+1)
+}
+
+func (f *GsonFile) openChunk() error {
+	file, err := os.Create(f.currentPath())
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.hash = sha256.New()
+	f.count = &countWriter{w: io.MultiWriter(file, f.hash)}
+	f.written = 0
+	if err := f.newWriter(); err != nil {
+		file.Close()
+		return err
+	}
+	return nil
+}
+
+// newWriter starts a new compressed stream in the current file
+func (f *GsonFile) newWriter() error {
+	var err error
+	switch f.compression {
+	case CompressionGzip:
+		f.writer = gzip.NewWriter(f.count)
+	case CompressionZstd:
+		f.writer, err = zstd.NewWriter(f.count)
+	default:
+		f.writer = nopWriteCloser{f.count}
+	}
+	return err
+}
+
+// Checkpoint flushes the data written so far to disk and
+// returns the position of the file.
+//
+// The current compressed stream is ended and a new one is started,
+// readers of gzip and zstd files read the streams one after the other.
+func (f *GsonFile) Checkpoint() (GsonFileState, error) {
+	s := GsonFileState{
+		Chunks: append([]GsonChunk{}, f.manifest.Chunks...),
+	}
+	if f.writer == nil {
+		return s, nil
+	}
+	if err := f.writer.Close(); err != nil {
+		return s, err
+	}
+	if err := f.newWriter(); err != nil {
+		return s, err
+	}
+	if err := f.file.Sync(); err != nil {
+		return s, err
+	}
+	s.Open = true
+	s.Offset = f.count.n
+	s.Written = f.written
+	return s, nil
+}
+
+// ResumeGsonFile continues writing a dump at the position
+// returned by Checkpoint. Data written after the checkpoint
+// is discarded.
+func ResumeGsonFile(path string, compression string, chunkSize int64, state GsonFileState) (*GsonFile, error) {
+	f := &GsonFile{
+		path:        path,
+		compression: compression,
+		chunkSize:   chunkSize,
+		manifest: GsonManifest{
+			Compression: compression,
+			Chunks:      append([]GsonChunk{}, state.Chunks...),
+		},
+	}
+	if !state.Open {
+		return f, nil
+	}
+	file, err := os.OpenFile(f.currentPath(), os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(state.Offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// the checksum of the chunk includes the data already written
+	f.hash = sha256.New()
+	if _, err := io.CopyN(f.hash, file, state.Offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(state.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.file = file
+	f.count = &countWriter{w: io.MultiWriter(file, f.hash), n: state.Offset}
+	f.written = state.Written
+	if err := f.newWriter(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *GsonFile) closeChunk() error {
+	path := f.currentPath()
+	if err := f.writer.Close(); err != nil {
+		return err
+	}
+	f.writer = nil
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.chunkSize > 0 {
+		f.manifest.Chunks = append(f.manifest.Chunks, GsonChunk{
+			Path:   filepath.Base(path),
+			Size:   f.count.n,
+			SHA256: hex.EncodeToString(f.hash.Sum(nil)),
+		})
+	}
+	return nil
+}
+
+// Write writes GraphSON data to the current chunk
+func (f *GsonFile) Write(p []byte) (int, error) {
+	if f.writer == nil {
+		if err := f.openChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.writer.Write(p)
+	f.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if f.chunkSize > 0 && f.written >= f.chunkSize && bytes.HasSuffix(p, []byte("\n")) {
+		return n, f.closeChunk()
+	}
+	return n, nil
+}
+
+// Close closes the current chunk and writes the
+// manifest when the dump is chunked
+func (f *GsonFile) Close() error {
+	if f.writer != nil {
+		if err := f.closeChunk(); err != nil {
+			return err
+		}
+	}
+	if f.chunkSize == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(f.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(ManifestPath(f.path), data)
+}
+
+func writeFile(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openCompressed opens the file and detects its
+// compression from the first bytes
+func openCompressed(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return newDecompressor(file, file)
+}
+
+// newDecompressor detects the compression of r from its first
+// bytes. file is closed when the returned reader is closed.
+func newDecompressor(r io.Reader, file io.Closer) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return readCloser{Reader: gr, closers: []io.Closer{gr, file}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		rc := zr.IOReadCloser()
+		return readCloser{Reader: rc, closers: []io.Closer{rc, file}}, nil
+	default:
+		return readCloser{Reader: br, closers: []io.Closer{file}}, nil
+	}
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// chunkReader reads a chunk and checks its size
+// and checksum once it has been read
+type chunkReader struct {
+	io.ReadCloser
+	chunk GsonChunk
+	hash  hash.Hash
+	count *countReader
+}
+
+func openChunkReader(dir string, chunk GsonChunk) (*chunkReader, error) {
+	file, err := os.Open(filepath.Join(dir, chunk.Path))
+	if err != nil {
+		return nil, err
+	}
+	r := &chunkReader{
+		chunk: chunk,
+		hash:  sha256.New(),
+	}
+	r.count = &countReader{r: io.TeeReader(file, r.hash)}
+	rc, err := newDecompressor(r.count, file)
+	if err != nil {
+		return nil, err
+	}
+	r.ReadCloser = rc
+	return r, nil
+}
+
+// verify reads the rest of the file and compares
+// its size and checksum with the manifest
+func (r *chunkReader) verify() error {
+	if _, err := io.Copy(ioutil.Discard, r.count); err != nil {
+		return err
+	}
+	if r.count.n != r.chunk.Size {
+		return fmt.Errorf("chunk %s: size is %d, expected %d", r.chunk.Path, r.count.n, r.chunk.Size)
+	}
+	if sum := hex.EncodeToString(r.hash.Sum(nil)); sum != r.chunk.SHA256 {
+		return fmt.Errorf("chunk %s: checksum is %s, expected %s", r.chunk.Path, sum, r.chunk.SHA256)
+	}
+	return nil
+}
+
+// chunksReader reads the chunks of a manifest one after the other.
+// Each chunk is verified once it has been read.
+type chunksReader struct {
+	dir     string
+	chunks  []GsonChunk
+	current *chunkReader
+}
+
+func (r *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			cr, err := openChunkReader(r.dir, r.chunks[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current = cr
+			r.chunks = r.chunks[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.verify()
+			r.current.Close()
+			r.current = nil
+			if err != nil {
+				return n, err
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunksReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// OpenGsonFile opens a dump written by GsonFile. The compression
+// is detected from the content of the file. When path is a
+// manifest the chunks are read in order.
+func OpenGsonFile(path string) (io.ReadCloser, error) {
+	if !strings.HasSuffix(path, ManifestSuffix) {
+		return openCompressed(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var manifest GsonManifest
+	if err := json.NewDecoder(file).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &chunksReader{
+		dir:    filepath.Dir(path),
+		chunks: manifest.Chunks,
+	}, nil
+}
@@ -0,0 +1,107 @@
+package gremlin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkPath(t *testing.T) {
+	assert.Equal(t, "/tmp/dump.0002.json.gz", chunkPath("/tmp/dump.json.gz", 2))
+	assert.Equal(t, "dump.0001", chunkPath("dump", 1))
+	assert.Equal(t, "/tmp/dump.manifest.json", ManifestPath("/tmp/dump.json.gz"))
+}
+
+func TestGsonFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gson")
+	defer os.RemoveAll(dir)
+
+	lines := []string{"{\"id\":1}\n", "{\"id\":2}\n", "{\"id\":3}\n"}
+
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		for _, chunkSize := range []int64{0, 10} {
+			path := filepath.Join(dir, "dump-"+compression+".json")
+			f, err := CreateGsonFile(path, compression, chunkSize)
+			assert.Nil(t, err)
+			for _, line := range lines {
+				f.Write([]byte(line))
+			}
+			assert.Nil(t, f.Close())
+
+			if chunkSize > 0 {
+				path = ManifestPath(path)
+			}
+			r, err := OpenGsonFile(path)
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+			r.Close()
+			assert.Equal(t, strings.Join(lines, ""), string(data), compression)
+		}
+	}
+}
+
+func TestGsonFileResume(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gson")
+	defer os.RemoveAll(dir)
+
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		for _, chunkSize := range []int64{0, 10} {
+			path := filepath.Join(dir, "dump-"+compression+".json")
+			f, err := CreateGsonFile(path, compression, chunkSize)
+			assert.Nil(t, err)
+			f.Write([]byte("{\"id\":1}\n"))
+			f.Write([]byte("{\"id\":2}\n"))
+			f.Write([]byte("{\"id\":3}\n"))
+			state, err := f.Checkpoint()
+			assert.Nil(t, err)
+			// lost when the dump is interrupted
+			f.Write([]byte("{\"id\":4}\n"))
+
+			f, err = ResumeGsonFile(path, compression, chunkSize, state)
+			assert.Nil(t, err)
+			f.Write([]byte("{\"id\":5}\n"))
+			assert.Nil(t, f.Close())
+
+			if chunkSize > 0 {
+				path = ManifestPath(path)
+			}
+			r, err := OpenGsonFile(path)
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+			r.Close()
+			assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n{\"id\":5}\n", string(data), compression)
+		}
+	}
+}
+
+func TestGsonFileChecksum(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gson")
+	defer os.RemoveAll(dir)
+
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		path := filepath.Join(dir, "dump-"+compression+".json")
+		f, err := CreateGsonFile(path, compression, 5)
+		assert.Nil(t, err)
+		f.Write([]byte("{\"id\":1}\n"))
+		f.Write([]byte("{\"id\":2}\n"))
+		assert.Nil(t, f.Close())
+
+		// the second chunk was modified
+		chunk := chunkPath(path, 2)
+		data, _ := ioutil.ReadFile(chunk)
+		data = append(data, data...)
+		ioutil.WriteFile(chunk, data, 0644)
+
+		r, err := OpenGsonFile(ManifestPath(path))
+		assert.Nil(t, err)
+		_, err = ioutil.ReadAll(r)
+		assert.NotNil(t, err, compression)
+		r.Close()
+	}
+}
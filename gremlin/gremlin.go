@@ -2,7 +2,6 @@ package gremlin
 
 import (
 	"encoding/json"
-	"strings"
 
 	"github.com/satori/go.uuid"
 )
@@ -65,32 +64,11 @@ func (v *Vertex) AddSingleProperty(name string, value interface{}) {
 	v.Properties[name] = []Property{Property{Value: value}}
 }
 
-// PropertyValue can find a value in a map[string]interface{} Property value
+// PropertyValue can find a value in a map[string]interface{} Property value.
+// See Value for the path syntax.
 func (v *Vertex) PropertyValue(path string) (interface{}, bool) {
-	keys := strings.Split(path, ".")
-	if data, ok := v.Properties[keys[0]]; ok {
-		if len(keys) == 1 {
-			return data, true
-		}
-		return findValue(keys[1:], data[0].Value)
-	}
-	return nil, false
-}
-
-func findValue(path []string, data interface{}) (interface{}, bool) {
-	switch data.(type) {
-	case map[string]interface{}:
-		next, ok := data.(map[string]interface{})[path[0]]
-		if !ok {
-			return nil, false
-		}
-		if len(path) == 1 {
-			return next, true
-		}
-		return findValue(path[1:], next)
-	default:
-		return nil, true
-	}
+	value, err := v.Value(path)
+	return value, err == nil
 }
 
 func (v *Vertex) HasProp(name string) bool {
@@ -122,30 +100,70 @@ func (v *Vertex) AddOutEdge(edge Edge) {
 	}
 }
 
+// OutEdges returns the out edges of the vertex. The vertex
+// end of each edge is set to the vertex ID if missing.
+func (v *Vertex) OutEdges() []Edge {
+	edges := make([]Edge, 0)
+	for _, es := range v.OutE {
+		for _, e := range es {
+			if e.OutV == uuid.Nil {
+				e.OutV = v.ID
+			}
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// Edges returns all edges of the vertex. The vertex end
+// of each edge is set to the vertex ID if missing.
+func (v *Vertex) Edges() []Edge {
+	edges := make([]Edge, 0)
+	// ref, parent
+	for _, es := range v.OutE {
+		for _, e := range es {
+			if e.OutV == uuid.Nil {
+				e.OutV = v.ID
+			}
+			edges = append(edges, e)
+		}
+	}
+	// back_ref, children
+	for _, es := range v.InE {
+		for _, e := range es {
+			if e.InV == uuid.Nil {
+				e.InV = v.ID
+			}
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// sanitizePropertyValue converts json numbers and copies maps
+// and lists so that the value is not shared with the caller
 func sanitizePropertyValue(value interface{}) interface{} {
-	switch value.(type) {
+	switch value := value.(type) {
 	case map[string]interface{}:
-		for k, v := range value.(map[string]interface{}) {
-			value.(map[string]interface{})[k] = sanitizePropertyValue(v)
+		m := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			m[k] = sanitizePropertyValue(v)
 		}
-		return value
+		return m
 	case []interface{}:
-		for i, v := range value.([]interface{}) {
-			value.([]interface{})[i] = sanitizePropertyValue(v)
+		l := make([]interface{}, len(value))
+		for i, v := range value {
+			l[i] = sanitizePropertyValue(v)
 		}
-		return value
-	case string:
-		return value.(string)
-	case bool:
-		return value.(bool)
+		return l
 	case json.Number:
-		if n, err := value.(json.Number).Int64(); err == nil {
+		if n, err := value.Int64(); err == nil {
 			return n
 		}
-		if n, err := value.(json.Number).Float64(); err == nil {
+		if n, err := value.Float64(); err == nil {
 			return n
 		}
-		return value.(json.Number).String()
+		return value.String()
 	default:
 		return value
 	}
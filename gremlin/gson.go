@@ -1,9 +1,15 @@
 package gremlin
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 
@@ -14,6 +20,9 @@ var (
 	// ErrDuplicateVertex indicates a vertex with the same
 	// ID has been writen to the gson file
 	ErrDuplicateVertex = errors.New("Duplicate Vertex")
+	// ErrCheckpointDeterministic indicates that the state of a
+	// deterministic backend can't be saved
+	ErrCheckpointDeterministic = errors.New("can't checkpoint a deterministic backend")
 )
 
 // GsonValue is a GSON value
@@ -24,13 +33,21 @@ type GsonValue struct {
 
 func (v *GsonValue) UnmarshalJSON(data []byte) error {
 	var value map[string]interface{}
-	err := json.Unmarshal(data, &value)
+	err := unmarshalJSON(data, &value)
 	if err != nil {
 		return err
 	}
 	return v.fill(value)
 }
 
+// unmarshalJSON decodes numbers as json.Number so
+// that g:Int64 values don't lose precision
+func unmarshalJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
 func (v *GsonValue) fill(value map[string]interface{}) error {
 	v.Type = value["@type"].(string)
 	switch v.Type {
@@ -40,16 +57,84 @@ func (v *GsonValue) fill(value map[string]interface{}) error {
 			return err
 		}
 		v.Value = uuid
+	case "g:Int32":
+		n, err := toInt64(value["@value"])
+		if err != nil {
+			return err
+		}
+		v.Value = int32(n)
 	case "g:Int64":
-		v.Value = int64(value["@value"].(float64))
+		n, err := toInt64(value["@value"])
+		if err != nil {
+			return err
+		}
+		v.Value = n
 	case "g:Float64":
-		v.Value = value["@value"].(float64)
+		n, err := toFloat64(value["@value"])
+		if err != nil {
+			return err
+		}
+		v.Value = n
+	// g:Map values are a flat list of keys and values
+	case "g:List", "g:Map":
+		list, ok := value["@value"].([]interface{})
+		if !ok {
+			return fmt.Errorf("invalid %s value: %v", v.Type, value["@value"])
+		}
+		values := make([]interface{}, len(list))
+		for i, item := range list {
+			filled, err := fillGsonValue(item)
+			if err != nil {
+				return err
+			}
+			values[i] = filled
+		}
+		v.Value = values
 	default:
 		v.Value = value["@value"]
 	}
 	return nil
 }
 
+// fillGsonValue returns a GsonValue if value is a typed value
+func fillGsonValue(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case map[string]interface{}:
+		if _, ok := value.(map[string]interface{})["@type"]; !ok {
+			return value, nil
+		}
+		gv := GsonValue{}
+		if err := gv.fill(value.(map[string]interface{})); err != nil {
+			return nil, err
+		}
+		return gv, nil
+	default:
+		return value, nil
+	}
+}
+
+func toInt64(value interface{}) (int64, error) {
+	switch value.(type) {
+	case json.Number:
+		return value.(json.Number).Int64()
+	case float64:
+		return int64(value.(float64)), nil
+	default:
+		return 0, fmt.Errorf("invalid integer value: %v", value)
+	}
+}
+
+func toFloat64(value interface{}) (float64, error) {
+	switch value.(type) {
+	case json.Number:
+		return value.(json.Number).Float64()
+	case float64:
+		return value.(float64), nil
+	default:
+		return 0, fmt.Errorf("invalid float value: %v", value)
+	}
+}
+
 type GsonProperty struct {
 	ID    GsonValue   `json:"id"`
 	Value interface{} `json:"value"`
@@ -57,18 +142,11 @@ type GsonProperty struct {
 
 func (p *GsonProperty) UnmarshalJSON(data []byte) (err error) {
 	type GsonProperty2 GsonProperty
-	if err := json.Unmarshal(data, (*GsonProperty2)(p)); err != nil {
+	if err := unmarshalJSON(data, (*GsonProperty2)(p)); err != nil {
 		return err
 	}
-	switch p.Value.(type) {
-	case map[string]interface{}:
-		value := GsonValue{}
-		if err := value.fill(p.Value.(map[string]interface{})); err != nil {
-			return err
-		}
-		p.Value = value
-	}
-	return nil
+	p.Value, err = fillGsonValue(p.Value)
+	return err
 }
 
 type GsonEdge struct {
@@ -80,18 +158,15 @@ type GsonEdge struct {
 
 func (e *GsonEdge) UnmarshalJSON(data []byte) error {
 	type GsonEdge2 GsonEdge
-	if err := json.Unmarshal(data, (*GsonEdge2)(e)); err != nil {
+	if err := unmarshalJSON(data, (*GsonEdge2)(e)); err != nil {
 		return err
 	}
 	for k, v := range e.Properties {
-		switch v.(type) {
-		case map[string]interface{}:
-			value := GsonValue{}
-			if err := value.fill(v.(map[string]interface{})); err != nil {
-				return err
-			}
-			e.Properties[k] = value
+		value, err := fillGsonValue(v)
+		if err != nil {
+			return err
 		}
+		e.Properties[k] = value
 	}
 	return nil
 }
@@ -112,7 +187,7 @@ func (v GsonVertex) toJSON(indent ...bool) ([]byte, error) {
 }
 
 func (v *GsonVertex) fromJSON(data []byte) error {
-	return json.Unmarshal(data, v)
+	return unmarshalJSON(data, v)
 }
 
 // UUID returns the UUID of the current vertex
@@ -120,20 +195,153 @@ func (v GsonVertex) UUID() uuid.UUID {
 	return v.ID.Value.(uuid.UUID)
 }
 
+// toVertex converts the vertex to a Vertex. Labels of the
+// other side of the edges are not part of GraphSON and are
+// left empty.
+func (v GsonVertex) toVertex() Vertex {
+	vertex := Vertex{
+		ID:         v.UUID(),
+		Label:      v.Label,
+		Properties: make(map[string][]Property, len(v.Properties)),
+		InE:        make(map[string][]Edge, len(v.InE)),
+		OutE:       make(map[string][]Edge, len(v.OutE)),
+	}
+	for name, props := range v.Properties {
+		for _, prop := range props {
+			vertex.AddProperty(name, fromGsonPropertyValue(prop.Value))
+		}
+	}
+	// back_ref, children
+	for label, edges := range v.InE {
+		for _, ge := range edges {
+			e := Edge{
+				Label:    label,
+				InV:      vertex.ID,
+				InVLabel: vertex.Label,
+			}
+			if ge.OutV != nil {
+				e.OutV = ge.OutV.Value.(uuid.UUID)
+			}
+			for name, value := range ge.Properties {
+				e.AddProperty(name, fromGsonPropertyValue(value))
+			}
+			vertex.AddInEdge(e)
+		}
+	}
+	// ref, parent
+	for label, edges := range v.OutE {
+		for _, ge := range edges {
+			e := Edge{
+				Label:     label,
+				OutV:      vertex.ID,
+				OutVLabel: vertex.Label,
+			}
+			if ge.InV != nil {
+				e.InV = ge.InV.Value.(uuid.UUID)
+			}
+			for name, value := range ge.Properties {
+				e.AddProperty(name, fromGsonPropertyValue(value))
+			}
+			vertex.AddOutEdge(e)
+		}
+	}
+	return vertex
+}
+
+// fromGsonPropertyValue is the reverse of newGsonPropertyValue
+func fromGsonPropertyValue(value interface{}) interface{} {
+	switch value.(type) {
+	case GsonValue:
+		gv := value.(GsonValue)
+		switch gv.Type {
+		case "g:List":
+			list := gv.Value.([]interface{})
+			values := make([]interface{}, len(list))
+			for i, item := range list {
+				values[i] = fromGsonPropertyValue(item)
+			}
+			return values
+		case "g:Map":
+			list := gv.Value.([]interface{})
+			values := make(map[string]interface{}, len(list)/2)
+			for i := 0; i+1 < len(list); i += 2 {
+				values[fmt.Sprintf("%v", list[i])] = fromGsonPropertyValue(list[i+1])
+			}
+			return values
+		default:
+			return gv.Value
+		}
+	case []interface{}:
+		list := value.([]interface{})
+		values := make([]interface{}, len(list))
+		for i, item := range list {
+			values[i] = fromGsonPropertyValue(item)
+		}
+		return values
+	default:
+		return value
+	}
+}
+
+// GsonReader reads vertices from a GraphSON file
+// written by GsonBackend, one vertex per line
+type GsonReader struct {
+	input *bufio.Reader
+}
+
+// NewGsonReader returns a reader of the GraphSON input
+func NewGsonReader(input io.Reader) *GsonReader {
+	return &GsonReader{
+		input: bufio.NewReader(input),
+	}
+}
+
+// Read returns the next vertex of the input
+// or io.EOF when all vertices have been read
+func (r *GsonReader) Read() (Vertex, error) {
+	for {
+		line, err := r.input.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			gv := GsonVertex{}
+			if err := gv.fromJSON(line); err != nil {
+				return Vertex{}, err
+			}
+			return gv.toVertex(), nil
+		}
+		if err != nil {
+			return Vertex{}, err
+		}
+	}
+}
+
 type WriteAction struct {
 	vertex Vertex
 	result chan error
+	// run is called by the writer instead of writing vertex
+	run func() error
+}
+
+// GsonState is the bookkeeping of a GsonBackend needed
+// to continue writing a graph after a restart
+type GsonState struct {
+	Written []uuid.UUID      `json:"written"`
+	Pending []Vertex         `json:"pending"`
+	PropID  int64            `json:"propID"`
+	EdgeID  int64            `json:"edgeID"`
+	EdgeIDs map[string]int64 `json:"edgeIDs"`
 }
 
 type GsonBackend struct {
-	output  io.Writer
-	write   chan WriteAction
-	written map[uuid.UUID]bool
-	pending map[uuid.UUID]Vertex
-	propID  *int64           // property ID counter
-	edgeID  *int64           // edge ID counter
-	edgeIDs map[string]int64 // track edge IDs
-	wg      *sync.WaitGroup
+	output        io.Writer
+	write         chan WriteAction
+	written       map[uuid.UUID]bool
+	pending       map[uuid.UUID]Vertex
+	propID        *int64           // property ID counter
+	edgeID        *int64           // edge ID counter
+	edgeIDs       map[string]int64 // track edge IDs
+	deterministic bool
+	lines         lineSorter // vertices sorted until Stop in deterministic mode
+	wg            *sync.WaitGroup
 	sync.RWMutex
 }
 
@@ -150,6 +358,16 @@ func NewGsonBackend(output io.Writer) *GsonBackend {
 	}
 }
 
+// SetDeterministic makes the output of the backend only depend on
+// the written vertices. Vertices are written ordered by UUID on Stop,
+// property and edge IDs are derived from the vertices and edges.
+//
+// Vertices are sorted until Stop, above DeterministicRunSize they
+// are spilled to temporary files.
+func (b *GsonBackend) SetDeterministic(deterministic bool) {
+	b.deterministic = deterministic
+}
+
 func (b *GsonBackend) Start() {
 	go b.writer()
 }
@@ -159,6 +377,96 @@ func (b *GsonBackend) Stop() {
 	b.wg.Wait()
 }
 
+// Checkpoint calls fn with the state of the backend between two
+// writes, so the state matches what has been written to the output.
+func (b *GsonBackend) Checkpoint(fn func(GsonState) error) error {
+	if b.deterministic {
+		return ErrCheckpointDeterministic
+	}
+	return b.run(func() error {
+		return fn(b.state())
+	})
+}
+
+// Restore sets the state of the backend to a
+// state previously saved with Checkpoint
+func (b *GsonBackend) Restore(s GsonState) error {
+	return b.run(func() error {
+		b.restore(s)
+		return nil
+	})
+}
+
+func (b *GsonBackend) run(fn func() error) error {
+	a := WriteAction{
+		result: make(chan error, 1),
+		run:    fn,
+	}
+	b.write <- a
+	return <-a.result
+}
+
+func (b *GsonBackend) state() GsonState {
+	s := GsonState{
+		Written: make([]uuid.UUID, 0, len(b.written)),
+		Pending: make([]Vertex, 0, len(b.pending)),
+		PropID:  atomic.LoadInt64(b.propID),
+		EdgeID:  atomic.LoadInt64(b.edgeID),
+		EdgeIDs: make(map[string]int64),
+	}
+	for id := range b.written {
+		s.Written = append(s.Written, id)
+	}
+	for _, v := range b.pending {
+		s.Pending = append(s.Pending, v)
+	}
+	b.RLock()
+	defer b.RUnlock()
+	// edge IDs are only looked up again when one
+	// side of the edge has not been written yet
+	for ref, id := range b.edgeIDs {
+		outV, _ := uuid.FromString(ref[:36])
+		inV, _ := uuid.FromString(ref[37:73])
+		if !b.written[outV] || !b.written[inV] {
+			s.EdgeIDs[ref] = id
+		}
+	}
+	return s
+}
+
+func (b *GsonBackend) restore(s GsonState) {
+	for _, id := range s.Written {
+		b.written[id] = true
+	}
+	// properties of pending vertices don't survive JSON encoding
+	for _, v := range s.Pending {
+		pendingV := newPendingV(v.ID, v.Label)
+		pendingV.InE = v.InE
+		pendingV.OutE = v.OutE
+		b.pending[v.ID] = pendingV
+	}
+	atomic.StoreInt64(b.propID, s.PropID)
+	atomic.StoreInt64(b.edgeID, s.EdgeID)
+	b.Lock()
+	defer b.Unlock()
+	for ref, id := range s.EdgeIDs {
+		b.edgeIDs[ref] = id
+	}
+}
+
+func newPendingV(id uuid.UUID, label string) Vertex {
+	pendingV := Vertex{
+		ID:         id,
+		Label:      label,
+		Properties: map[string][]Property{},
+		InE:        map[string][]Edge{},
+		OutE:       map[string][]Edge{},
+	}
+	pendingV.AddSingleProperty("fq_name", []string{"_missing"})
+	pendingV.AddSingleProperty("_missing", true)
+	return pendingV
+}
+
 func (b *GsonBackend) addPendingV(v Vertex) {
 	// First we check that for each edge of the vertex
 	// we already have written the other vertex
@@ -172,15 +480,7 @@ func (b *GsonBackend) addPendingV(v Vertex) {
 			}
 			pendingV, ok := b.pending[e.InV]
 			if !ok {
-				pendingV = Vertex{
-					ID:         e.InV,
-					Label:      e.InVLabel,
-					Properties: map[string][]Property{},
-					InE:        map[string][]Edge{},
-					OutE:       map[string][]Edge{},
-				}
-				pendingV.AddSingleProperty("fq_name", []string{"_missing"})
-				pendingV.AddSingleProperty("_missing", true)
+				pendingV = newPendingV(e.InV, e.InVLabel)
 				b.pending[pendingV.ID] = pendingV
 			}
 			pendingV.AddInEdge(Edge{
@@ -199,15 +499,7 @@ func (b *GsonBackend) addPendingV(v Vertex) {
 			}
 			pendingV, ok := b.pending[e.OutV]
 			if !ok {
-				pendingV = Vertex{
-					ID:         e.OutV,
-					Label:      e.OutVLabel,
-					Properties: map[string][]Property{},
-					InE:        map[string][]Edge{},
-					OutE:       map[string][]Edge{},
-				}
-				pendingV.AddProperty("fq_name", []string{"_missing"})
-				pendingV.AddProperty("_missing", true)
+				pendingV = newPendingV(e.OutV, e.OutVLabel)
 				b.pending[pendingV.ID] = pendingV
 			}
 			pendingV.AddOutEdge(Edge{
@@ -224,12 +516,27 @@ func (b *GsonBackend) writer() {
 	b.wg.Add(1)
 	defer b.wg.Done()
 	for a := range b.write {
+		if a.run != nil {
+			a.result <- a.run()
+			continue
+		}
 		b.addPendingV(a.vertex)
 		a.result <- b.writeVertex(a.vertex)
 	}
 	for _, v := range b.pending {
 		b.writeVertex(v)
 	}
+	if b.deterministic {
+		b.writeLines()
+	}
+}
+
+// writeLines writes the vertices kept in
+// deterministic mode ordered by UUID
+func (b *GsonBackend) writeLines() {
+	if err := b.lines.writeTo(b.output); err != nil {
+		log.Errorf("Failed to write vertices: %s", err)
+	}
 }
 
 func (b *GsonBackend) writeVertex(v Vertex) error {
@@ -241,15 +548,20 @@ func (b *GsonBackend) writeVertex(v Vertex) error {
 	if err != nil {
 		return err
 	}
-	_, err = b.output.Write(vJSON)
-	if err != nil {
+	// each vertex is written in one call so that
+	// GsonFile can split the output between lines
+	vJSON = append(vJSON, '\n')
+	if b.deterministic {
+		if err := b.lines.add(v.ID, vJSON); err != nil {
+			return err
+		}
+	} else if _, err := b.output.Write(vJSON); err != nil {
 		return err
 	}
 	b.written[gv.UUID()] = true
 	if _, ok := b.pending[v.ID]; ok {
 		delete(b.pending, v.ID)
 	}
-	b.output.Write([]byte("\n"))
 	return nil
 }
 
@@ -260,6 +572,16 @@ func (b *GsonBackend) newGsonProperty(value interface{}) GsonProperty {
 	}
 }
 
+// contentID returns a positive ID derived from the given parts
+func contentID(parts ...string) int64 {
+	h := fnv.New64a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return int64(h.Sum64() >> 1)
+}
+
 func newUUIDValue(uuid uuid.UUID) GsonValue {
 	return GsonValue{Type: "g:UUID", Value: uuid}
 }
@@ -285,9 +607,14 @@ func newListValue(value []interface{}) GsonValue {
 }
 
 func newMapValue(value map[string]interface{}) GsonValue {
-	mapList := make([]interface{}, 0)
-	for k, v := range value {
-		mapList = append(mapList, k, newGsonPropertyValue(v))
+	keys := make([]string, 0, len(value))
+	for k := range value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	mapList := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		mapList = append(mapList, k, newGsonPropertyValue(value[k]))
 	}
 	return GsonValue{Type: "g:Map", Value: mapList}
 }
@@ -320,9 +647,46 @@ func (b *GsonBackend) getGsonEdgeID(ref string) int64 {
 	return b.edgeIDs[ref]
 }
 
+// edgeRefs returns the refs identifying each edge of edges between
+// both sides of the edges. Edges with the same vertices, label and
+// properties are told apart by their occurrence, which doesn't depend
+// on the order of the edges.
+func edgeRefs(v Vertex, label string, edges []Edge) []string {
+	var (
+		refs  = make([]string, len(edges))
+		count = make(map[string]int)
+	)
+	for i, e := range edges {
+		outV, inV := e.OutV, e.InV
+		if outV == uuid.Nil {
+			outV = v.ID
+		}
+		if inV == uuid.Nil {
+			inV = v.ID
+		}
+		props := make(map[string]interface{})
+		for name, prop := range e.Properties {
+			if prop.Value != nil {
+				props[name] = prop.Value
+			}
+		}
+		propsJSON, _ := json.Marshal(props)
+		ref := fmt.Sprintf("%s-%s-%s-%s", outV, inV, label, propsJSON)
+		refs[i] = fmt.Sprintf("%s-%d", ref, count[ref])
+		count[ref]++
+	}
+	return refs
+}
+
 func (b *GsonBackend) newGsonEdge(v Vertex, e Edge, ref string) GsonEdge {
+	var id int64
+	if b.deterministic {
+		id = contentID(ref)
+	} else {
+		id = b.getGsonEdgeID(ref)
+	}
 	ge := GsonEdge{
-		ID:         newInt64Value(b.getGsonEdgeID(ref)),
+		ID:         newInt64Value(id),
 		Properties: make(map[string]interface{}),
 	}
 	if e.OutV != uuid.Nil && e.OutV != v.ID {
@@ -351,9 +715,18 @@ func (b *GsonBackend) newGsonVertex(v Vertex) GsonVertex {
 			gv.Properties = make(map[string][]GsonProperty)
 		}
 		gv.Properties[name] = make([]GsonProperty, 0)
-		for _, prop := range propList {
-			gv.Properties[name] = append(gv.Properties[name],
-				b.newGsonProperty(newGsonPropertyValue(prop.Value)))
+		for i, prop := range propList {
+			value := newGsonPropertyValue(prop.Value)
+			var gp GsonProperty
+			if b.deterministic {
+				gp = GsonProperty{
+					ID:    newInt64Value(contentID(v.ID.String(), name, strconv.Itoa(i))),
+					Value: value,
+				}
+			} else {
+				gp = b.newGsonProperty(value)
+			}
+			gv.Properties[name] = append(gv.Properties[name], gp)
 		}
 	}
 	for name, edgeList := range v.InE {
@@ -361,9 +734,9 @@ func (b *GsonBackend) newGsonVertex(v Vertex) GsonVertex {
 			gv.InE = make(map[string][]GsonEdge)
 		}
 		gv.InE[name] = make([]GsonEdge, 0)
-		for _, edge := range edgeList {
-			ref := edge.OutV.String() + "-" + v.ID.String()
-			gv.InE[name] = append(gv.InE[name], b.newGsonEdge(v, edge, ref))
+		edges := b.sortEdges(edgeList)
+		for i, ref := range edgeRefs(v, name, edges) {
+			gv.InE[name] = append(gv.InE[name], b.newGsonEdge(v, edges[i], ref))
 		}
 	}
 	for name, edgeList := range v.OutE {
@@ -371,14 +744,31 @@ func (b *GsonBackend) newGsonVertex(v Vertex) GsonVertex {
 			gv.OutE = make(map[string][]GsonEdge)
 		}
 		gv.OutE[name] = make([]GsonEdge, 0)
-		for _, edge := range edgeList {
-			ref := v.ID.String() + "-" + edge.InV.String()
-			gv.OutE[name] = append(gv.OutE[name], b.newGsonEdge(v, edge, ref))
+		edges := b.sortEdges(edgeList)
+		for i, ref := range edgeRefs(v, name, edges) {
+			gv.OutE[name] = append(gv.OutE[name], b.newGsonEdge(v, edges[i], ref))
 		}
 	}
 	return gv
 }
 
+// sortEdges orders the edges by their vertices in deterministic
+// mode. Edges of pending vertices are added in arrival order.
+func (b *GsonBackend) sortEdges(edges []Edge) []Edge {
+	if !b.deterministic {
+		return edges
+	}
+	sorted := make([]Edge, len(edges))
+	copy(sorted, edges)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].OutV != sorted[j].OutV {
+			return bytes.Compare(sorted[i].OutV.Bytes(), sorted[j].OutV.Bytes()) < 0
+		}
+		return bytes.Compare(sorted[i].InV.Bytes(), sorted[j].InV.Bytes()) < 0
+	})
+	return sorted
+}
+
 func (b *GsonBackend) Create(v Vertex) error {
 	a := WriteAction{
 		vertex: v,
@@ -2,6 +2,7 @@ package gremlin
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"testing"
 
@@ -226,3 +227,196 @@ func TestJSON(t *testing.T) {
 
 	assert.Equal(t, gv1, gv2)
 }
+
+func TestRead(t *testing.T) {
+	var data []byte
+	buf := bytes.NewBuffer(data)
+	b := NewGsonBackend(buf)
+	b.Start()
+
+	id1, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddProperty("prop1", 397437162835365200)
+	v1.AddProperty("prop2", map[string]interface{}{
+		"list": []interface{}{1, "bar"},
+	})
+	v1.AddProperty("fq_name", []interface{}{"foo"})
+	id2, _ := uuid.NewV4()
+	e1 := Edge{
+		Label:    "ref",
+		InV:      id2,
+		InVLabel: "bar",
+	}
+	e1.AddProperty("prop3", 1)
+	v1.AddOutEdge(e1)
+	b.Create(v1)
+	b.Stop()
+
+	r := NewGsonReader(buf)
+	rv1, err := r.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, id1, rv1.ID)
+	assert.Equal(t, "foo", rv1.Label)
+	assert.Equal(t, int64(397437162835365200), rv1.Properties["prop1"][0].Value)
+	assert.Equal(t, map[string]interface{}{
+		"list": []interface{}{int64(1), "bar"},
+	}, rv1.Properties["prop2"][0].Value)
+	assert.Equal(t, []interface{}{"foo"}, rv1.Properties["fq_name"][0].Value)
+	assert.Equal(t, []Edge{{
+		Label:      "ref",
+		OutV:       id1,
+		OutVLabel:  "foo",
+		InV:        id2,
+		Properties: map[string]Property{"prop3": {Value: int64(1)}},
+	}}, rv1.OutE["ref"])
+
+	// the pending vertex
+	rv2, err := r.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, id2, rv2.ID)
+	assert.Equal(t, id1, rv2.InE["ref"][0].OutV)
+
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDeterministicWrite(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddProperty("prop1", map[string]interface{}{"a": 1, "b": 2, "c": 3})
+	v1.AddOutEdge(Edge{Label: "ref", InV: id3, InVLabel: "bar"})
+	v2 := Vertex{
+		ID:    id2,
+		Label: "foo",
+	}
+	v2.AddProperty("prop1", "foo")
+	v2.AddOutEdge(Edge{Label: "ref", InV: id3, InVLabel: "bar"})
+
+	write := func(vs ...Vertex) string {
+		var data []byte
+		buf := bytes.NewBuffer(data)
+		b := NewGsonBackend(buf)
+		b.SetDeterministic(true)
+		b.Start()
+		for _, v := range vs {
+			b.Create(v)
+		}
+		b.Stop()
+		return buf.String()
+	}
+
+	assert.Equal(t, write(v1, v2), write(v2, v1))
+
+	// vertices are spilled to temporary files
+	expected := write(v1, v2)
+	runSize := DeterministicRunSize
+	DeterministicRunSize = 1
+	defer func() { DeterministicRunSize = runSize }()
+	assert.Equal(t, expected, write(v2, v1))
+}
+
+func TestMultiEdgeIDs(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddOutEdge(Edge{Label: "ref", InV: id2, InVLabel: "bar"})
+	v1.AddOutEdge(Edge{Label: "ref", InV: id2, InVLabel: "bar"})
+	e := Edge{Label: "ref", InV: id2, InVLabel: "bar"}
+	e.AddProperties(map[string]interface{}{"attr": "foo"})
+	v1.AddOutEdge(e)
+
+	for _, deterministic := range []bool{false, true} {
+		var buf bytes.Buffer
+		b := NewGsonBackend(&buf)
+		b.SetDeterministic(deterministic)
+		b.Start()
+		b.Create(v1)
+		b.Stop()
+
+		gvs := make(map[string]GsonVertex)
+		for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+			gv := GsonVertex{}
+			gv.fromJSON(line)
+			gvs[gv.Label] = gv
+		}
+		outIDs := make(map[interface{}]bool)
+		for _, e := range gvs["foo"].OutE["ref"] {
+			outIDs[e.ID.Value] = true
+		}
+		inIDs := make(map[interface{}]bool)
+		for _, e := range gvs["bar"].InE["ref"] {
+			inIDs[e.ID.Value] = true
+		}
+		assert.Equal(t, 3, len(outIDs))
+		assert.Equal(t, outIDs, inIDs)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddProperty("prop1", "foo")
+	v1.AddOutEdge(Edge{Label: "ref", OutV: id1, InV: id2, InVLabel: "bar"})
+
+	var buf bytes.Buffer
+	b := NewGsonBackend(&buf)
+	b.Start()
+	b.Create(v1)
+	var state GsonState
+	err := b.Checkpoint(func(s GsonState) error {
+		state = s
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uuid.UUID{id1}, state.Written)
+	assert.Equal(t, 1, len(state.Pending))
+
+	// the state is saved as JSON by gremlin-dump
+	data, _ := json.Marshal(state)
+	state = GsonState{}
+	json.Unmarshal(data, &state)
+
+	var buf2 bytes.Buffer
+	b2 := NewGsonBackend(&buf2)
+	b2.Start()
+	assert.Nil(t, b2.Restore(state))
+	assert.Equal(t, ErrDuplicateVertex, b2.Create(v1))
+	b2.Stop()
+
+	// the pending vertex is written when the backend is stopped
+	// with the same edge ID than the first side of the edge
+	line2 := append([]byte{}, buf2.Bytes()...)
+	reader := NewGsonReader(&buf2)
+	v2, err := reader.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, id2, v2.ID)
+	assert.True(t, v2.HasProp("_missing"))
+	_, err = reader.Read()
+	assert.Equal(t, io.EOF, err)
+
+	gv1 := GsonVertex{}
+	gv1.fromJSON(bytes.TrimSpace(buf.Bytes()))
+	gv2 := GsonVertex{}
+	gv2.fromJSON(bytes.TrimSpace(line2))
+	assert.Equal(t, gv1.OutE["ref"][0].ID, gv2.InE["ref"][0].ID)
+	assert.NotEqual(t, gv1.Properties["prop1"][0].ID, gv2.Properties["fq_name"][0].ID)
+
+	b3 := NewGsonBackend(&buf)
+	b3.SetDeterministic(true)
+	assert.Equal(t, ErrCheckpointDeterministic, b3.Checkpoint(func(s GsonState) error { return nil }))
+}
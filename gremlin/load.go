@@ -0,0 +1,101 @@
+package gremlin
+
+import (
+	"io"
+
+	"github.com/satori/go.uuid"
+)
+
+// LoadGson upserts the vertices of a GraphSON file written by
+// GsonBackend and returns the number of vertices loaded.
+//
+// GraphSON doesn't store the label of the other side of the
+// edges, so the edges of a vertex can only be sent once the other
+// sides have been read. When an edge of a vertex points to a vertex
+// that comes later in the file, only the properties of the vertex are
+// upserted and its edges are upserted after all vertices are loaded,
+// so that the current edges of the vertex are never removed meanwhile.
+// Edges to vertices that are not in the file are dropped.
+func (b *ServerBackend) LoadGson(input io.Reader) (int, error) {
+	var (
+		reader   = NewGsonReader(input)
+		labels   = make(map[uuid.UUID]string)
+		batch    = make([]Vertex, 0, UpsertBatchSize)
+		deferred = make([]Vertex, 0, UpsertBatchSize)
+		edges    []Vertex
+		count    = 0
+	)
+	flush := func() error {
+		if err := b.upsertVertices(batch, upsertAll); err != nil {
+			return err
+		}
+		if err := b.upsertVertices(deferred, upsertProperties); err != nil {
+			return err
+		}
+		count += len(batch) + len(deferred)
+		batch = batch[:0]
+		deferred = deferred[:0]
+		return nil
+	}
+	for {
+		v, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		labels[v.ID] = v.Label
+		if resolved, ok := resolveEdges(v, labels); ok {
+			batch = append(batch, resolved)
+		} else {
+			deferred = append(deferred, v)
+			// keep only the edges until all labels are known
+			edges = append(edges, Vertex{ID: v.ID, Label: v.Label, InE: v.InE, OutE: v.OutE})
+		}
+		if len(batch)+len(deferred) >= UpsertBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	for i, v := range edges {
+		edges[i], _ = resolveEdges(v, labels)
+	}
+	return count, b.upsertVertices(edges, upsertEdges)
+}
+
+// resolveEdges sets the label of the other side of the edges of v
+// and removes edges whose other side has not been read yet. It
+// returns false when edges were removed.
+func resolveEdges(v Vertex, labels map[uuid.UUID]string) (Vertex, bool) {
+	resolved := true
+	inE := make(map[string][]Edge, len(v.InE))
+	for label, edges := range v.InE {
+		for _, e := range edges {
+			if outVLabel, ok := labels[e.OutV]; ok {
+				e.OutVLabel = outVLabel
+				inE[label] = append(inE[label], e)
+			} else {
+				resolved = false
+			}
+		}
+	}
+	outE := make(map[string][]Edge, len(v.OutE))
+	for label, edges := range v.OutE {
+		for _, e := range edges {
+			if inVLabel, ok := labels[e.InV]; ok {
+				e.InVLabel = inVLabel
+				outE[label] = append(outE[label], e)
+			} else {
+				resolved = false
+			}
+		}
+	}
+	v.InE = inE
+	v.OutE = outE
+	return v, resolved
+}
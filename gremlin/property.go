@@ -0,0 +1,166 @@
+package gremlin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPropertyNotFound indicates that a property path doesn't exist
+	ErrPropertyNotFound = errors.New("property not found")
+	// ErrPropertyType indicates that a property value doesn't have the requested type
+	ErrPropertyType = errors.New("unexpected property type")
+)
+
+// PropertyError is returned by the property accessors of Vertex.
+// Err is ErrPropertyNotFound or ErrPropertyType.
+type PropertyError struct {
+	Path string
+	Err  error
+}
+
+func (e PropertyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// IsPropertyNotFound returns true if err indicates a missing property
+func IsPropertyNotFound(err error) bool {
+	e, ok := err.(PropertyError)
+	return ok && e.Err == ErrPropertyNotFound
+}
+
+// Value returns the value at path. The first key of path is the
+// property name, next keys are map keys or list indexes
+// (eg: id_perms.created, virtual_machine_interface_mac_addresses.mac_address.0).
+// For multi-valued properties the first value is used.
+func (v *Vertex) Value(path string) (interface{}, error) {
+	keys := strings.Split(path, ".")
+	props, ok := v.Properties[keys[0]]
+	if !ok || len(props) == 0 {
+		return nil, PropertyError{Path: path, Err: ErrPropertyNotFound}
+	}
+	value := props[0].Value
+	for _, key := range keys[1:] {
+		switch data := value.(type) {
+		case map[string]interface{}:
+			if value, ok = data[key]; !ok {
+				return nil, PropertyError{Path: path, Err: ErrPropertyNotFound}
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, PropertyError{Path: path, Err: ErrPropertyType}
+			}
+			if idx < 0 || idx >= len(data) {
+				return nil, PropertyError{Path: path, Err: ErrPropertyNotFound}
+			}
+			value = data[idx]
+		case nil:
+			return nil, PropertyError{Path: path, Err: ErrPropertyNotFound}
+		default:
+			return nil, PropertyError{Path: path, Err: ErrPropertyType}
+		}
+	}
+	if value == nil {
+		return nil, PropertyError{Path: path, Err: ErrPropertyNotFound}
+	}
+	return value, nil
+}
+
+// String returns the string at path
+func (v *Vertex) String(path string) (string, error) {
+	value, err := v.Value(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", PropertyError{Path: path, Err: ErrPropertyType}
+	}
+	return s, nil
+}
+
+// Int64 returns the integer at path
+func (v *Vertex) Int64(path string) (int64, error) {
+	value, err := v.Value(path)
+	if err != nil {
+		return 0, err
+	}
+	switch n := value.(type) {
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), nil
+		}
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+	}
+	return 0, PropertyError{Path: path, Err: ErrPropertyType}
+}
+
+// Bool returns the boolean at path
+func (v *Vertex) Bool(path string) (bool, error) {
+	value, err := v.Value(path)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, PropertyError{Path: path, Err: ErrPropertyType}
+	}
+	return b, nil
+}
+
+// Time returns the timestamp at path. Contrail timestamps
+// have no timezone and are in UTC.
+func (v *Vertex) Time(path string) (time.Time, error) {
+	s, err := v.String(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s+"Z"); err == nil {
+		return t, nil
+	}
+	return time.Time{}, PropertyError{Path: path, Err: ErrPropertyType}
+}
+
+// List returns the list at path
+func (v *Vertex) List(path string) ([]interface{}, error) {
+	value, err := v.Value(path)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := value.([]interface{})
+	if !ok {
+		return nil, PropertyError{Path: path, Err: ErrPropertyType}
+	}
+	return l, nil
+}
+
+// Map returns the map at path
+func (v *Vertex) Map(path string) (map[string]interface{}, error) {
+	value, err := v.Value(path)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, PropertyError{Path: path, Err: ErrPropertyType}
+	}
+	return m, nil
+}
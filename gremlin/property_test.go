@@ -0,0 +1,81 @@
+package gremlin
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropertyAccessors(t *testing.T) {
+	v := Vertex{Label: "virtual_machine_interface"}
+	v.AddProperty("id_perms", map[string]interface{}{
+		"enable":        true,
+		"created":       "2018-02-01T10:20:30.123456",
+		"last_modified": 42,
+		"description":   nil,
+		"uuid": map[string]interface{}{
+			"uuid_mslong": json.Number("1234"),
+		},
+	})
+	v.AddProperty("virtual_machine_interface_mac_addresses", map[string]interface{}{
+		"mac_address": []interface{}{"02:ab:cd:ef:00:01"},
+	})
+	v.AddProperty("name", "vmi")
+
+	s, err := v.String("name")
+	assert.Nil(t, err)
+	assert.Equal(t, "vmi", s)
+
+	b, err := v.Bool("id_perms.enable")
+	assert.Nil(t, err)
+	assert.True(t, b)
+
+	i, err := v.Int64("id_perms.uuid.uuid_mslong")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), i)
+
+	created, err := v.Time("id_perms.created")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2018, 2, 1, 10, 20, 30, 123456000, time.UTC), created)
+
+	l, err := v.List("virtual_machine_interface_mac_addresses.mac_address")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"02:ab:cd:ef:00:01"}, l)
+
+	s, err = v.String("virtual_machine_interface_mac_addresses.mac_address.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "02:ab:cd:ef:00:01", s)
+
+	m, err := v.Map("id_perms.uuid")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"uuid_mslong": int64(1234)}, m)
+
+	_, err = v.String("foo")
+	assert.Equal(t, PropertyError{Path: "foo", Err: ErrPropertyNotFound}, err)
+	assert.True(t, IsPropertyNotFound(err))
+	_, err = v.String("id_perms.description")
+	assert.True(t, IsPropertyNotFound(err))
+	_, err = v.String("virtual_machine_interface_mac_addresses.mac_address.1")
+	assert.True(t, IsPropertyNotFound(err))
+
+	_, err = v.String("name.foo")
+	assert.Equal(t, PropertyError{Path: "name.foo", Err: ErrPropertyType}, err)
+	_, err = v.Time("id_perms.last_modified")
+	assert.Equal(t, PropertyError{Path: "id_perms.last_modified", Err: ErrPropertyType}, err)
+	_, err = v.Int64("id_perms.enable")
+	assert.Equal(t, PropertyError{Path: "id_perms.enable", Err: ErrPropertyType}, err)
+	_, err = v.Map("virtual_machine_interface_mac_addresses.mac_address")
+	assert.False(t, IsPropertyNotFound(err))
+}
+
+func TestAddPropertyCopiesValue(t *testing.T) {
+	value := map[string]interface{}{"a": json.Number("1")}
+	v := Vertex{}
+	v.AddProperty("prop", value)
+	assert.Equal(t, json.Number("1"), value["a"])
+	i, err := v.Int64("prop.a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), i)
+}
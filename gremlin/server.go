@@ -8,10 +8,11 @@ import (
 	"sort"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/eonpatapon/gremlin"
-	"github.com/google/go-cmp/cmp"
 	logging "github.com/op/go-logging"
+	"github.com/satori/go.uuid"
 )
 
 var (
@@ -21,12 +22,19 @@ var (
 	ErrIncompleteVertex = errors.New("vertex is incomplete")
 )
 
+const (
+	// UpsertBatchSize is the maximum number of vertices
+	// sent in one script by UpsertVertices
+	UpsertBatchSize = 20
+)
+
 // ServerBackend handles operations against gremlin-server
 type ServerBackend struct {
 	client               *gremlin.Client
 	connected            atomic.Value
 	connectedHandlers    []func()
 	disconnectedHandlers []func(error)
+	queryHandlers        []func(time.Duration, error)
 }
 
 // NewServerBackend is the connection to the gremlin-server
@@ -35,6 +43,7 @@ func NewServerBackend(gremlinURI string) *ServerBackend {
 		client:               gremlin.NewClient(gremlinURI),
 		connectedHandlers:    []func(){},
 		disconnectedHandlers: []func(error){},
+		queryHandlers:        []func(time.Duration, error){},
 	}
 	b.connected.Store(false)
 	b.client.AddConnectedHandler(b.onConnected)
@@ -52,6 +61,12 @@ func (b *ServerBackend) AddDisconnectedHandler(h func(error)) {
 	b.disconnectedHandlers = append(b.disconnectedHandlers, h)
 }
 
+// AddQueryHandler runs handler after each request with
+// the duration and the error of the request
+func (b *ServerBackend) AddQueryHandler(h func(time.Duration, error)) {
+	b.queryHandlers = append(b.queryHandlers, h)
+}
+
 func (b *ServerBackend) IsConnected() bool {
 	return b.connected.Load().(bool)
 }
@@ -92,7 +107,12 @@ func (b *ServerBackend) Connected() bool {
 
 // Send request to underlying client
 func (b *ServerBackend) Send(req *gremlin.Request) ([]byte, error) {
-	return b.client.Send(req)
+	start := time.Now()
+	data, err := b.client.Send(req)
+	for _, h := range b.queryHandlers {
+		h(time.Since(start), err)
+	}
+	return data, err
 }
 
 // CreateVertex creates a vertex and its associated edges
@@ -148,26 +168,120 @@ func (b *ServerBackend) CreateEdge(e Edge) error {
 
 // UpdateVertex updates properties and edges of the given vertex
 func (b *ServerBackend) UpdateVertex(v Vertex) error {
-	if v.Label == "" {
-		return ErrIncompleteVertex
+	return b.UpsertVertices([]Vertex{v})
+}
+
+// UpsertVertices creates or updates the given vertices with their edges.
+// Vertices are sent by batches of UpsertBatchSize, each batch being applied
+// by a single script. When the graph supports transactions the whole batch
+// is committed at once or not at all.
+func (b *ServerBackend) UpsertVertices(vs []Vertex) error {
+	return b.upsertVertices(vs, upsertAll)
+}
+
+// upsertParts selects what is written by an upsert
+type upsertParts int
+
+const (
+	upsertProperties upsertParts = 1 << iota
+	upsertEdges
+	upsertAll = upsertProperties | upsertEdges
+)
+
+// upsertVertices upserts the parts of the vertices vs. The other
+// parts of existing vertices are kept.
+func (b *ServerBackend) upsertVertices(vs []Vertex, parts upsertParts) error {
+	for _, v := range vs {
+		if v.Label == "" {
+			return ErrIncompleteVertex
+		}
+	}
+	for start := 0; start < len(vs); start += UpsertBatchSize {
+		end := start + UpsertBatchSize
+		if end > len(vs) {
+			end = len(vs)
+		}
+		if err := b.upsertBatch(vs[start:end], parts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newUpsertBatch(vs []Vertex, parts upsertParts) []upsertVertex {
+	batch := make([]upsertVertex, len(vs))
+	for i, v := range vs {
+		batch[i] = newUpsertVertex(v)
+		if parts&upsertProperties == 0 {
+			batch[i].Properties = nil
+		}
+		if parts&upsertEdges == 0 {
+			batch[i].Edges = nil
+		}
 	}
-	props, bindings := vertexPropertiesQuery(v.Properties)
-	bindings["_id"] = v.ID
-	bindings["_label"] = v.Label
-	query := `g.V().hasId(_id).fold().
-			  coalesce(unfold().sideEffect(properties().drop()),
-					   addV(_label).property(id, _id))
-			 ` + props + `.iterate()`
+	return batch
+}
+
+func (b *ServerBackend) upsertBatch(vs []Vertex, parts upsertParts) error {
+	// The vertices are passed as a single binding because gremlin-server
+	// limits the number of parameters of a request.
+	bindings := gremlin.Bind{"_vertices": newUpsertBatch(vs, parts)}
 	_, err := b.Send(
-		gremlin.Query(query).Bindings(bindings),
+		gremlin.Query(upsertScript).Bindings(bindings),
 	)
-	if err != nil {
-		if err == gremlin.ErrStatusInvalidRequestArguments {
-			log.Errorf("Query: %s, Bindings: %s", query, bindings)
+	// The request doesn't fit in a websocket frame, split the batch
+	if err == gremlin.ErrLargeRequest {
+		if len(vs) == 1 {
+			return b.upsertLargeVertex(vs[0], parts)
+		}
+		if err := b.upsertBatch(vs[:len(vs)/2], parts); err != nil {
+			return err
 		}
+		return b.upsertBatch(vs[len(vs)/2:], parts)
+	}
+	if err == gremlin.ErrStatusInvalidRequestArguments {
+		log.Errorf("Query: %s, Bindings: %s", upsertScript, bindings)
+	}
+	return err
+}
+
+// upsertLargeVertex upserts a vertex with too many edges to be sent
+// in one request. The properties are sent first, then the diff with
+// the current edges is sent in as many requests as needed. The edges
+// are not updated atomically.
+func (b *ServerBackend) upsertLargeVertex(v Vertex, parts upsertParts) error {
+	bindings := gremlin.Bind{"_vertices": newUpsertBatch([]Vertex{v}, parts&upsertProperties)}
+	_, err := b.Send(
+		gremlin.Query(upsertScript).Bindings(bindings),
+	)
+	if err != nil || parts&upsertEdges == 0 {
+		return err
+	}
+	diff, err := b.diffVertexEdges(v)
+	if err != nil {
 		return err
 	}
-	return b.updateVertexEdges(v)
+	return b.sendEdgeOps(v.ID, newEdgeOps(diff))
+}
+
+func (b *ServerBackend) sendEdgeOps(id uuid.UUID, ops []edgeOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	bindings := gremlin.Bind{"_id": id, "_ops": ops}
+	_, err := b.Send(
+		gremlin.Query(edgeOpsScript).Bindings(bindings),
+	)
+	if err == gremlin.ErrLargeRequest && len(ops) > 1 {
+		if err := b.sendEdgeOps(id, ops[:len(ops)/2]); err != nil {
+			return err
+		}
+		return b.sendEdgeOps(id, ops[len(ops)/2:])
+	}
+	if err == gremlin.ErrStatusInvalidRequestArguments {
+		log.Errorf("Query: %s, Bindings: %s", edgeOpsScript, bindings)
+	}
+	return err
 }
 
 // UpdateEdge updates properties of the given edge
@@ -233,9 +347,31 @@ func (b *ServerBackend) UpdateVertexProperty(v Vertex, name string, value interf
 	return nil
 }
 
-func (b *ServerBackend) currentVertexEdges(v Vertex) (edges []Edge, err error) {
-	var data []byte
-	data, err = b.Send(
+// serverEdge is an edge as returned by gremlin-server. In GraphSON
+// edge properties are not wrapped in a value object.
+type serverEdge struct {
+	OutV       uuid.UUID              `json:"outV"`
+	OutVLabel  string                 `json:"outVLabel"`
+	InV        uuid.UUID              `json:"inV"`
+	InVLabel   string                 `json:"inVLabel"`
+	Label      string                 `json:"label"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+func (se serverEdge) toEdge() Edge {
+	e := Edge{
+		OutV:      se.OutV,
+		OutVLabel: se.OutVLabel,
+		InV:       se.InV,
+		InVLabel:  se.InVLabel,
+		Label:     se.Label,
+	}
+	e.AddProperties(se.Properties)
+	return e
+}
+
+func (b *ServerBackend) currentVertexEdges(v Vertex) ([]Edge, error) {
+	data, err := b.Send(
 		gremlin.Query(`g.V(_id).bothE()`).Bindings(
 			gremlin.Bind{
 				"_id": v.ID.String(),
@@ -245,123 +381,96 @@ func (b *ServerBackend) currentVertexEdges(v Vertex) (edges []Edge, err error) {
 	if err != nil {
 		return nil, err
 	}
-	json.Unmarshal(data, &edges)
-
-	return edges, err
-}
-
-func (b *ServerBackend) diffVertexEdges(v Vertex) ([]Edge, []Edge, []Edge, error) {
-	var (
-		toAdd    []Edge
-		toRemove []Edge
-		toUpdate []Edge
-	)
-
-	currentEdges, err := b.currentVertexEdges(v)
-	if err != nil {
-		return toAdd, toUpdate, toRemove, err
-	}
-
-	var vertexEdges []Edge
-	for _, edges := range v.OutE {
-		vertexEdges = append(vertexEdges, edges...)
+	var serverEdges []serverEdge
+	if len(data) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&serverEdges); err != nil {
+			return nil, err
+		}
 	}
-	for _, edges := range v.InE {
-		vertexEdges = append(vertexEdges, edges...)
+	edges := make([]Edge, len(serverEdges))
+	for i, se := range serverEdges {
+		edges[i] = se.toEdge()
 	}
+	return edges, nil
+}
 
-	for _, l1 := range vertexEdges {
-		found := false
-		update := false
-		for _, l2 := range currentEdges {
-			if l1.InV == l2.InV && l1.OutV == l2.OutV && l1.Label == l2.Label {
-				found = true
-				if !cmp.Equal(l1.Properties, l2.Properties) {
-					update = true
-				}
-				break
-			}
-		}
-		if !found {
-			toAdd = append(toAdd, l1)
-		}
-		if found && update {
-			toUpdate = append(toUpdate, l1)
-		}
+// VertexIDs returns the IDs of all vertices of the graph
+func (b *ServerBackend) VertexIDs() ([]uuid.UUID, error) {
+	data, err := b.Send(gremlin.Query(`g.V().id()`))
+	if err != nil {
+		return nil, err
 	}
-
-	for _, l1 := range currentEdges {
-		found := false
-		for _, l2 := range vertexEdges {
-			if l1.InV == l2.InV && l1.OutV == l2.OutV && l1.Label == l2.Label {
-				found = true
-				break
-			}
-		}
-		if !found {
-			toRemove = append(toRemove, l1)
+	var ids []uuid.UUID
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return nil, err
 		}
 	}
-
-	return toAdd, toUpdate, toRemove, nil
+	return ids, nil
 }
 
-func (b *ServerBackend) updateVertexEdges(v Vertex) error {
-	toAdd, toUpdate, toRemove, err := b.diffVertexEdges(v)
+// ReadVertices returns the vertices ids with their properties and out
+// edges in a single query. In edges are the out edges of other vertices.
+// Vertices that don't exist are not returned.
+func (b *ServerBackend) ReadVertices(ids []uuid.UUID) ([]Vertex, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = id.String()
+	}
+	data, err := b.Send(
+		gremlin.Query(`g.V(_ids.toArray()).project('id', 'label', 'properties', 'edges')
+			.by(id).by(label).by(valueMap()).by(outE().fold())`).Bindings(
+			gremlin.Bind{
+				"_ids": strIDs,
+			},
+		),
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	for _, edge := range toAdd {
-		err = b.CreateEdge(edge)
-		if err != nil {
-			return err
-		}
+	var results []struct {
+		ID         uuid.UUID                `json:"id"`
+		Label      string                   `json:"label"`
+		Properties map[string][]interface{} `json:"properties"`
+		Edges      []serverEdge             `json:"edges"`
 	}
-
-	for _, edge := range toUpdate {
-		err = b.UpdateEdge(edge)
-		if err != nil {
-			return err
+	if len(data) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&results); err != nil {
+			return nil, err
 		}
 	}
-
-	for _, edge := range toRemove {
-		err = b.DeleteEdge(edge)
-		if err != nil {
-			return err
+	vertices := make([]Vertex, len(results))
+	for i, result := range results {
+		v := Vertex{
+			ID:    result.ID,
+			Label: result.Label,
 		}
+		for name, values := range result.Properties {
+			for _, value := range values {
+				v.AddProperty(name, value)
+			}
+		}
+		for _, se := range result.Edges {
+			v.AddOutEdge(se.toEdge())
+		}
+		vertices[i] = v
 	}
-
-	return nil
+	return vertices, nil
 }
 
-func vertexPropertiesQuery(propList map[string][]Property) (string, gremlin.Bind) {
-	var buffer bytes.Buffer
-	bindings := gremlin.Bind{}
-	propNames := make([]string, len(propList))
-	i := 0
-	for name := range propList {
-		propNames[i] = name
-		i++
-	}
-	sort.SliceStable(propNames, func(i, j int) bool {
-		return propNames[i] < propNames[j]
-	})
-	for _, propName := range propNames {
-		for i, value := range propList[propName] {
-			bindName := fmt.Sprintf(`_%s_%d`, strings.Replace(propName, `.`, `_`, -1), i)
-			buffer.WriteString(`.property(`)
-			if len(propList[propName]) > 1 {
-				buffer.WriteString(`list,`)
-			}
-			buffer.WriteString(fmt.Sprintf(`'%s',`, propName))
-			buffer.WriteString(bindName)
-			buffer.WriteString(`)`)
-			bindings[bindName] = value.Value
-		}
+func (b *ServerBackend) diffVertexEdges(v Vertex) (EdgeDiff, error) {
+	currentEdges, err := b.currentVertexEdges(v)
+	if err != nil {
+		return EdgeDiff{}, err
 	}
-	return buffer.String(), bindings
+	return NewEdgeDiff(currentEdges, v.Edges()).KeepInEdges(v.ID), nil
 }
 
 func edgePropertiesQuery(propList map[string]Property) (string, gremlin.Bind) {
@@ -1,6 +1,7 @@
 package gremlin
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
 	"testing"
@@ -164,26 +165,26 @@ func TestEdgeDiff(t *testing.T) {
 	}
 	v2.AddOutEdge(e2)
 
-	toAdd, toUpdate, toRemove, _ := b.diffVertexEdges(v2)
-	assert.Equal(t, 1, len(toAdd))
-	assert.Equal(t, 0, len(toUpdate))
-	assert.Equal(t, 0, len(toRemove))
+	diff, _ := b.diffVertexEdges(v2)
+	assert.Equal(t, 1, len(diff.Add))
+	assert.Equal(t, 0, len(diff.Update))
+	assert.Equal(t, 0, len(diff.Remove))
 
 	b.UpdateVertex(v2)
 
-	toAdd, toUpdate, toRemove, _ = b.diffVertexEdges(v2)
-	assert.Equal(t, 0, len(toAdd))
-	assert.Equal(t, 0, len(toUpdate))
-	assert.Equal(t, 0, len(toRemove))
+	diff, _ = b.diffVertexEdges(v2)
+	assert.Equal(t, 0, len(diff.Add))
+	assert.Equal(t, 0, len(diff.Update))
+	assert.Equal(t, 0, len(diff.Remove))
 
 	v2.OutE = map[string][]Edge{}
 	e2.Label = "parent"
 	v2.AddOutEdge(e2)
 
-	toAdd, toUpdate, toRemove, _ = b.diffVertexEdges(v2)
-	assert.Equal(t, 1, len(toAdd))
-	assert.Equal(t, 0, len(toUpdate))
-	assert.Equal(t, 1, len(toRemove))
+	diff, _ = b.diffVertexEdges(v2)
+	assert.Equal(t, 1, len(diff.Add))
+	assert.Equal(t, 0, len(diff.Update))
+	assert.Equal(t, 1, len(diff.Remove))
 
 	v2.OutE = map[string][]Edge{}
 	e2.Properties = map[string]Property{}
@@ -191,10 +192,10 @@ func TestEdgeDiff(t *testing.T) {
 	e2.AddProperty("foo", "bar")
 	v2.AddOutEdge(e2)
 
-	toAdd, toUpdate, toRemove, _ = b.diffVertexEdges(v2)
-	assert.Equal(t, 0, len(toAdd))
-	assert.Equal(t, 1, len(toUpdate))
-	assert.Equal(t, 0, len(toRemove))
+	diff, _ = b.diffVertexEdges(v2)
+	assert.Equal(t, 0, len(diff.Add))
+	assert.Equal(t, 1, len(diff.Update))
+	assert.Equal(t, 0, len(diff.Remove))
 
 	v3 := Vertex{
 		ID:    id2,
@@ -207,10 +208,10 @@ func TestEdgeDiff(t *testing.T) {
 	}
 	v3.AddOutEdge(e3)
 
-	toAdd, toUpdate, toRemove, _ = b.diffVertexEdges(v3)
-	assert.Equal(t, 0, len(toAdd))
-	assert.Equal(t, 0, len(toUpdate))
-	assert.Equal(t, 0, len(toRemove))
+	diff, _ = b.diffVertexEdges(v3)
+	assert.Equal(t, 0, len(diff.Add))
+	assert.Equal(t, 0, len(diff.Update))
+	assert.Equal(t, 0, len(diff.Remove))
 
 	b.Stop()
 }
@@ -252,3 +253,427 @@ func TestIndirectCreate(t *testing.T) {
 
 	b.Stop()
 }
+
+func TestUpsertVertices(t *testing.T) {
+	b := NewServerBackend("ws://127.0.0.1:8182/gremlin")
+	b.Start()
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddProperty("prop1", "foo")
+	v1.AddOutEdge(Edge{
+		Label:    "ref",
+		OutV:     id1,
+		InV:      id2,
+		InVLabel: "bar",
+	})
+	v1.AddOutEdge(Edge{
+		Label:    "parent",
+		OutV:     id1,
+		InV:      id3,
+		InVLabel: "baz",
+	})
+	v2 := Vertex{
+		ID:    id2,
+		Label: "bar",
+	}
+	v2.AddProperty("prop2", "bar")
+	v2.AddInEdge(Edge{
+		Label:     "ref",
+		OutV:      id1,
+		OutVLabel: "foo",
+		InV:       id2,
+	})
+
+	err := b.UpsertVertices([]Vertex{v1, v2})
+	assert.Nil(t, err)
+
+	var uuids []string
+	r, _ := b.Send(
+		gremlin.Query(`g.V(id1).out('ref').has('prop2', 'bar').not(has('_missing')).id()`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &uuids)
+	assert.Equal(t, []string{id2.String()}, uuids)
+
+	uuids = []string{}
+	r, _ = b.Send(
+		gremlin.Query(`g.V(id1).out('parent').has('_missing', true).id()`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &uuids)
+	assert.Equal(t, []string{id3.String()}, uuids)
+
+	var count []int
+	r, _ = b.Send(
+		gremlin.Query(`g.V(id1).bothE().count()`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &count)
+	assert.Equal(t, []int{2}, count)
+
+	err = b.UpsertVertices([]Vertex{Vertex{ID: id1}})
+	assert.Equal(t, ErrIncompleteVertex, err)
+
+	b.Stop()
+}
+
+func TestLoadGson(t *testing.T) {
+	var data []byte
+	buf := bytes.NewBuffer(data)
+	gb := NewGsonBackend(buf)
+	gb.Start()
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddProperty("prop1", map[string]interface{}{"bar": 1})
+	v1.AddOutEdge(Edge{
+		Label:    "ref",
+		InV:      id2,
+		InVLabel: "bar",
+	})
+	gb.Create(v1)
+	gb.Stop()
+
+	b := NewServerBackend("ws://127.0.0.1:8182/gremlin")
+	b.Start()
+
+	count, err := b.LoadGson(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	var uuids []string
+	r, _ := b.Send(
+		gremlin.Query(`g.V(id1).out('ref').has('_missing', true).id()`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &uuids)
+	assert.Equal(t, []string{id2.String()}, uuids)
+
+	var values []int
+	r, _ = b.Send(
+		gremlin.Query(`g.V(id1).values('prop1').select('bar')`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &values)
+	assert.Equal(t, []int{1}, values)
+
+	b.Stop()
+}
+
+func TestReadVertices(t *testing.T) {
+	b := NewServerBackend("ws://127.0.0.1:8182/gremlin")
+	b.Start()
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddProperty("prop1", "foo")
+	e := Edge{
+		Label:    "ref",
+		OutV:     id1,
+		InV:      id2,
+		InVLabel: "bar",
+	}
+	e.AddProperty("attr", "baz")
+	v1.AddOutEdge(e)
+	v2 := Vertex{
+		ID:    id2,
+		Label: "bar",
+	}
+	v2.AddProperty("prop1", "bar")
+	v2.AddInEdge(Edge{
+		Label:     "ref",
+		OutV:      id1,
+		OutVLabel: "foo",
+		InV:       id2,
+	})
+	assert.Nil(t, b.UpsertVertices([]Vertex{v1, v2}))
+
+	// id3 doesn't exist
+	vertices, err := b.ReadVertices([]uuid.UUID{id1, id2, id3})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(vertices))
+	read := make(map[uuid.UUID]Vertex)
+	for _, v := range vertices {
+		read[v.ID] = v
+	}
+
+	// only out edges are read
+	assert.True(t, NewVertexDiff(v1, read[id1]).Empty())
+	assert.True(t, NewVertexDiff(v2, read[id2]).Empty())
+	assert.Equal(t, 1, len(read[id1].OutE["ref"]))
+	assert.Equal(t, 0, len(read[id2].InE))
+
+	b.Stop()
+}
+
+func TestUpsertInEdgeProperties(t *testing.T) {
+	b := NewServerBackend("ws://127.0.0.1:8182/gremlin")
+	b.Start()
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddProperty("prop1", "foo")
+	e := Edge{
+		Label:    "ref",
+		OutV:     id1,
+		InV:      id2,
+		InVLabel: "bar",
+	}
+	e.AddProperty("attr", "baz")
+	v1.AddOutEdge(e)
+	v2 := Vertex{
+		ID:    id2,
+		Label: "bar",
+	}
+	v2.AddProperty("prop1", "bar")
+	v2.AddInEdge(Edge{
+		Label:     "ref",
+		OutV:      id1,
+		OutVLabel: "foo",
+		InV:       id2,
+	})
+
+	attrs := func() []string {
+		var values []string
+		r, _ := b.Send(
+			gremlin.Query(`g.V(id1).outE('ref').values('attr')`).Bindings(
+				gremlin.Bind{"id1": id1},
+			),
+		)
+		json.Unmarshal(r, &values)
+		return values
+	}
+
+	// the in-edge of v2 doesn't replace the properties set by v1
+	assert.Nil(t, b.UpsertVertices([]Vertex{v1, v2}))
+	assert.Equal(t, []string{"baz"}, attrs())
+	assert.Nil(t, b.UpsertVertices([]Vertex{v2}))
+	assert.Equal(t, []string{"baz"}, attrs())
+	diff, _ := b.diffVertexEdges(v2)
+	assert.True(t, diff.Empty())
+
+	// the properties are updated by the vertex that owns the edge
+	v1.OutE["ref"][0].AddProperty("attr", "qux")
+	assert.Nil(t, b.UpsertVertices([]Vertex{v2, v1}))
+	assert.Equal(t, []string{"qux"}, attrs())
+
+	b.Stop()
+}
+
+func TestLoadGsonKeepEdges(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	v1.AddOutEdge(Edge{
+		Label:    "ref",
+		InV:      id2,
+		InVLabel: "bar",
+	})
+	v2 := Vertex{
+		ID:    id2,
+		Label: "bar",
+	}
+	v2.AddInEdge(Edge{
+		Label:     "ref",
+		OutV:      id1,
+		OutVLabel: "foo",
+	})
+
+	b := NewServerBackend("ws://127.0.0.1:8182/gremlin")
+	b.Start()
+	b.UpsertVertices([]Vertex{v1, v2})
+
+	var ids, newIDs []interface{}
+	query := gremlin.Query(`g.V(id1).outE('ref').id()`).Bindings(
+		gremlin.Bind{"id1": id1},
+	)
+	r, _ := b.Send(query)
+	json.Unmarshal(r, &ids)
+	assert.Equal(t, 1, len(ids))
+
+	// v1 comes before v2 in the file
+	var data []byte
+	buf := bytes.NewBuffer(data)
+	gb := NewGsonBackend(buf)
+	gb.Start()
+	v1.AddSingleProperty("prop1", "foo")
+	gb.Create(v1)
+	gb.Create(v2)
+	gb.Stop()
+
+	count, err := b.LoadGson(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// the edge was not removed while v2 was not loaded
+	r, _ = b.Send(query)
+	json.Unmarshal(r, &newIDs)
+	assert.Equal(t, ids, newIDs)
+
+	var values []string
+	r, _ = b.Send(
+		gremlin.Query(`g.V(id1).values('prop1')`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &values)
+	assert.Equal(t, []string{"foo"}, values)
+
+	b.Stop()
+}
+
+func TestUpsertLargeVertex(t *testing.T) {
+	b := NewServerBackend("ws://127.0.0.1:8182/gremlin")
+	b.Start()
+
+	id1, _ := uuid.NewV4()
+	v1 := Vertex{
+		ID:    id1,
+		Label: "foo",
+	}
+	// the edges of the vertex don't fit in a websocket frame
+	for i := 0; i < 1000; i++ {
+		id, _ := uuid.NewV4()
+		e := Edge{
+			Label:    "ref",
+			OutV:     id1,
+			InV:      id,
+			InVLabel: "bar",
+		}
+		e.AddProperty("index", i)
+		v1.AddOutEdge(e)
+	}
+
+	err := b.UpsertVertices([]Vertex{v1})
+	assert.Nil(t, err)
+
+	var count []int
+	r, _ := b.Send(
+		gremlin.Query(`g.V(id1).outE('ref').count()`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &count)
+	assert.Equal(t, []int{1000}, count)
+
+	edges := v1.OutE["ref"]
+	v1.OutE["ref"] = edges[:500]
+	for i := range v1.OutE["ref"][:10] {
+		v1.OutE["ref"][i].AddProperty("index", -1)
+	}
+
+	err = b.UpsertVertices([]Vertex{v1})
+	assert.Nil(t, err)
+
+	r, _ = b.Send(
+		gremlin.Query(`g.V(id1).outE('ref').count()`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &count)
+	assert.Equal(t, []int{500}, count)
+
+	r, _ = b.Send(
+		gremlin.Query(`g.V(id1).outE('ref').has('index', -1).count()`).Bindings(
+			gremlin.Bind{"id1": id1},
+		),
+	)
+	json.Unmarshal(r, &count)
+	assert.Equal(t, []int{10}, count)
+
+	b.Stop()
+}
+
+func TestUpsertMultipleEdges(t *testing.T) {
+	b := NewServerBackend("ws://127.0.0.1:8182/gremlin")
+	b.Start()
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+
+	newVertex := func(props ...int) Vertex {
+		v := Vertex{
+			ID:    id1,
+			Label: "foo",
+		}
+		for _, prop := range props {
+			e := Edge{
+				Label:    "ref",
+				OutV:     id1,
+				InV:      id2,
+				InVLabel: "bar",
+			}
+			e.AddProperty("prop", prop)
+			v.AddOutEdge(e)
+		}
+		return v
+	}
+	edgeID := func(prop int) interface{} {
+		var ids []interface{}
+		r, _ := b.Send(
+			gremlin.Query(`g.V(id1).outE('ref').has('prop', prop).id()`).Bindings(
+				gremlin.Bind{"id1": id1, "prop": prop},
+			),
+		)
+		json.Unmarshal(r, &ids)
+		if len(ids) != 1 {
+			return nil
+		}
+		return ids[0]
+	}
+
+	err := b.UpsertVertices([]Vertex{newVertex(1, 2)})
+	assert.Nil(t, err)
+	id1Edge, id2Edge := edgeID(1), edgeID(2)
+	assert.NotNil(t, id1Edge)
+	assert.NotNil(t, id2Edge)
+
+	// Edges are matched by properties, not by position
+	v := newVertex(2, 1)
+	diff, _ := b.diffVertexEdges(v)
+	assert.True(t, diff.Empty())
+	err = b.UpsertVertices([]Vertex{v})
+	assert.Nil(t, err)
+	assert.Equal(t, id1Edge, edgeID(1))
+	assert.Equal(t, id2Edge, edgeID(2))
+
+	// The edge that doesn't match is updated
+	v = newVertex(3, 2)
+	diff, _ = b.diffVertexEdges(v)
+	assert.Equal(t, 1, len(diff.Update))
+	err = b.UpsertVertices([]Vertex{v})
+	assert.Nil(t, err)
+	assert.Nil(t, edgeID(1))
+	assert.Equal(t, id1Edge, edgeID(3))
+	assert.Equal(t, id2Edge, edgeID(2))
+
+	b.Stop()
+}
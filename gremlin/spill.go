@@ -0,0 +1,152 @@
+package gremlin
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/satori/go.uuid"
+)
+
+// DeterministicRunSize is the size of the vertices kept in memory
+// by a deterministic GsonBackend before they are sorted and spilled
+// to a temporary file
+var DeterministicRunSize = 64 * 1024 * 1024
+
+// gsonLine is a vertex line of a deterministic GsonBackend
+type gsonLine struct {
+	id   uuid.UUID
+	data []byte
+}
+
+// lineSorter sorts the vertex lines by UUID with an external merge
+// sort. Lines are kept in memory until DeterministicRunSize is
+// reached, then the sorted run is written to a temporary file. Each
+// line of a run file is the UUID of the vertex followed by its line.
+type lineSorter struct {
+	lines []gsonLine
+	size  int
+	runs  []*os.File
+}
+
+func sortLines(lines []gsonLine) {
+	sort.Slice(lines, func(i, j int) bool {
+		return bytes.Compare(lines[i].id.Bytes(), lines[j].id.Bytes()) < 0
+	})
+}
+
+func (s *lineSorter) add(id uuid.UUID, data []byte) error {
+	s.lines = append(s.lines, gsonLine{id: id, data: data})
+	s.size += len(data)
+	if s.size >= DeterministicRunSize {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *lineSorter) spill() error {
+	sortLines(s.lines)
+	f, err := ioutil.TempFile("", "gremlin-gson")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+	w := bufio.NewWriter(f)
+	for _, l := range s.lines {
+		if _, err := w.WriteString(l.id.String()); err != nil {
+			return err
+		}
+		if _, err := w.Write(l.data); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	s.lines = nil
+	s.size = 0
+	return nil
+}
+
+// writeTo writes all the lines ordered by UUID to output
+// and removes the run files
+func (s *lineSorter) writeTo(output io.Writer) error {
+	defer s.close()
+	sortLines(s.lines)
+	if len(s.runs) == 0 {
+		for _, l := range s.lines {
+			if _, err := output.Write(l.data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(s.lines) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	return s.merge(output)
+}
+
+func (s *lineSorter) merge(output io.Writer) error {
+	var (
+		readers = make([]*bufio.Reader, len(s.runs))
+		heads   = make([]*gsonLine, len(s.runs))
+	)
+	next := func(i int) error {
+		line, err := readers[i].ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			heads[i] = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		id, err := uuid.FromString(string(line[:36]))
+		if err != nil {
+			return err
+		}
+		heads[i] = &gsonLine{id: id, data: line[36:]}
+		return nil
+	}
+	for i, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		readers[i] = bufio.NewReader(f)
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+	for {
+		min := -1
+		for i, head := range heads {
+			if head != nil && (min < 0 || bytes.Compare(head.id.Bytes(), heads[min].id.Bytes()) < 0) {
+				min = i
+			}
+		}
+		if min < 0 {
+			return nil
+		}
+		if _, err := output.Write(heads[min].data); err != nil {
+			return err
+		}
+		if err := next(min); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *lineSorter) close() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.runs = nil
+	s.lines = nil
+	s.size = 0
+}
@@ -1,8 +1,148 @@
 package gremlin
 
+import (
+	"strings"
+	"sync"
+)
+
+// AnyLabel registers a Transformer for vertices of any label
+const AnyLabel = "*"
+
+// Transformer modifies a vertex before it is written in the graph
+type Transformer func(v *Vertex) error
+
+// Transformers is a registry of transformers by vertex label
+type Transformers struct {
+	labels map[string][]Transformer
+	sync.RWMutex
+}
+
+// NewTransformers returns an empty registry
+func NewTransformers() *Transformers {
+	return &Transformers{
+		labels: make(map[string][]Transformer),
+	}
+}
+
+// Register adds a Transformer for vertices of label.
+// Transformers of AnyLabel run first, then transformers of the
+// vertex label, in registration order.
+func (ts *Transformers) Register(label string, t Transformer) {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.labels[label] = append(ts.labels[label], t)
+}
+
+// RegisterDefaults adds the default transformers
+func (ts *Transformers) RegisterDefaults() {
+	ts.Register(AnyLabel, FlattenIDPerms)
+	ts.Register("instance_ip", InstanceIPFamily)
+	ts.Register("virtual_machine_interface", NormalizeMACAddresses)
+	ts.Register("virtual_network", NetworkFlags)
+}
+
+// Transform applies the registered transformers to v
+func (ts *Transformers) Transform(v Vertex) (Vertex, error) {
+	ts.RLock()
+	t := append([]Transformer{}, ts.labels[AnyLabel]...)
+	if v.Label != AnyLabel {
+		t = append(t, ts.labels[v.Label]...)
+	}
+	ts.RUnlock()
+	for _, f := range t {
+		if err := f(&v); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// transformers is applied to the vertices read from
+// the contrail DB, it is empty by default
+var transformers = NewTransformers()
+
+// RegisterTransformer adds a Transformer for vertices of label
+// to the global registry
+func RegisterTransformer(label string, t Transformer) {
+	transformers.Register(label, t)
+}
+
+// RegisterDefaultTransformers adds the default
+// transformers to the global registry
+func RegisterDefaultTransformers() {
+	transformers.RegisterDefaults()
+}
+
+// TransformVertex applies the transformers of
+// the global registry to v
 func TransformVertex(v Vertex) (Vertex, error) {
-	switch v.Label {
-	default:
-		return v, nil
+	return transformers.Transform(v)
+}
+
+// FlattenIDPerms copies the id_perms fields in id_perms_<field>
+// properties (eg: id_perms_enable, id_perms_user_visible)
+func FlattenIDPerms(v *Vertex) error {
+	idPerms, err := v.Map("id_perms")
+	if err != nil {
+		return nil
+	}
+	for _, field := range []string{"enable", "user_visible", "description", "creator", "created", "last_modified"} {
+		if fieldValue, ok := idPerms[field]; ok && fieldValue != nil {
+			v.AddSingleProperty("id_perms_"+field, fieldValue)
+		}
+	}
+	return nil
+}
+
+// InstanceIPFamily sets instance_ip_family (v4 or v6) from
+// instance_ip_address when the family is missing
+func InstanceIPFamily(v *Vertex) error {
+	if v.HasProp("instance_ip_family") {
+		return nil
+	}
+	address, err := v.String("instance_ip_address")
+	if err != nil {
+		return nil
+	}
+	if strings.Contains(address, ":") {
+		v.AddSingleProperty("instance_ip_family", "v6")
+	} else {
+		v.AddSingleProperty("instance_ip_family", "v4")
+	}
+	return nil
+}
+
+// NormalizeMACAddresses lowercases the MAC addresses of a vmi and
+// sets mac_address to the first one
+func NormalizeMACAddresses(v *Vertex) error {
+	addresses, err := v.Map("virtual_machine_interface_mac_addresses")
+	if err != nil {
+		return nil
+	}
+	macs, ok := addresses["mac_address"].([]interface{})
+	if !ok {
+		return nil
+	}
+	normalized := make([]interface{}, 0, len(macs))
+	for _, mac := range macs {
+		if s, ok := mac.(string); ok {
+			normalized = append(normalized, strings.ToLower(s))
+		}
+	}
+	addresses["mac_address"] = normalized
+	if len(normalized) > 0 {
+		v.AddSingleProperty("mac_address", normalized[0])
+	}
+	return nil
+}
+
+// NetworkFlags sets router_external and is_shared to false when
+// they are not set on a virtual_network
+func NetworkFlags(v *Vertex) error {
+	for _, name := range []string{"router_external", "is_shared"} {
+		if _, err := v.Bool(name); err != nil {
+			v.AddSingleProperty(name, false)
+		}
 	}
+	return nil
 }
@@ -0,0 +1,98 @@
+package gremlin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterTransformer(t *testing.T) {
+	var calls []string
+	ts := NewTransformers()
+	ts.Register("transform_test", func(v *Vertex) error {
+		calls = append(calls, v.Label)
+		v.AddSingleProperty("transformed", true)
+		return nil
+	})
+
+	v, err := ts.Transform(Vertex{Label: "transform_test"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"transform_test"}, calls)
+	assert.True(t, v.HasProp("transformed"))
+
+	v, err = ts.Transform(Vertex{Label: "other"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"transform_test"}, calls)
+	assert.False(t, v.HasProp("transformed"))
+
+	errFail := errors.New("fail")
+	ts.Register("transform_fail", func(v *Vertex) error {
+		return errFail
+	})
+	_, err = ts.Transform(Vertex{Label: "transform_fail"})
+	assert.Equal(t, errFail, err)
+
+	// the global registry is empty by default
+	v, err = TransformVertex(Vertex{Label: "virtual_network"})
+	assert.Nil(t, err)
+	assert.False(t, v.HasProp("is_shared"))
+}
+
+func defaultTransformers() *Transformers {
+	ts := NewTransformers()
+	ts.RegisterDefaults()
+	return ts
+}
+
+func TestFlattenIDPerms(t *testing.T) {
+	v := Vertex{Label: "project"}
+	v.AddProperty("id_perms", map[string]interface{}{
+		"enable":       true,
+		"user_visible": false,
+		"description":  nil,
+		"created":      "2018-01-01T00:00:00.000000",
+	})
+	assert.Nil(t, FlattenIDPerms(&v))
+	assert.Equal(t, []Property{{Value: true}}, v.Properties["id_perms_enable"])
+	assert.Equal(t, []Property{{Value: false}}, v.Properties["id_perms_user_visible"])
+	assert.Equal(t, []Property{{Value: "2018-01-01T00:00:00.000000"}}, v.Properties["id_perms_created"])
+	assert.False(t, v.HasProp("id_perms_description"))
+}
+
+func TestInstanceIPFamily(t *testing.T) {
+	v := Vertex{Label: "instance_ip"}
+	v.AddProperty("instance_ip_address", "fd00::1")
+	v, _ = defaultTransformers().Transform(v)
+	assert.Equal(t, []Property{{Value: "v6"}}, v.Properties["instance_ip_family"])
+
+	v = Vertex{Label: "instance_ip"}
+	v.AddProperty("instance_ip_address", "10.0.0.1")
+	v, _ = defaultTransformers().Transform(v)
+	assert.Equal(t, []Property{{Value: "v4"}}, v.Properties["instance_ip_family"])
+
+	v = Vertex{Label: "instance_ip"}
+	v.AddProperty("instance_ip_address", "10.0.0.1")
+	v.AddProperty("instance_ip_family", "v6")
+	v, _ = defaultTransformers().Transform(v)
+	assert.Equal(t, []Property{{Value: "v6"}}, v.Properties["instance_ip_family"])
+}
+
+func TestNormalizeMACAddresses(t *testing.T) {
+	v := Vertex{Label: "virtual_machine_interface"}
+	v.AddProperty("virtual_machine_interface_mac_addresses", map[string]interface{}{
+		"mac_address": []interface{}{"02:AB:CD:EF:00:01"},
+	})
+	v, _ = defaultTransformers().Transform(v)
+	assert.Equal(t, []Property{{Value: "02:ab:cd:ef:00:01"}}, v.Properties["mac_address"])
+	value, _ := v.PropertyValue("virtual_machine_interface_mac_addresses.mac_address")
+	assert.Equal(t, []interface{}{"02:ab:cd:ef:00:01"}, value)
+}
+
+func TestNetworkFlags(t *testing.T) {
+	v := Vertex{Label: "virtual_network"}
+	v.AddProperty("router_external", true)
+	v, _ = defaultTransformers().Transform(v)
+	assert.Equal(t, []Property{{Value: true}}, v.Properties["router_external"])
+	assert.Equal(t, []Property{{Value: false}}, v.Properties["is_shared"])
+}
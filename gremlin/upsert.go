@@ -0,0 +1,227 @@
+package gremlin
+
+import (
+	"github.com/satori/go.uuid"
+)
+
+// edgeClosures are the groovy helpers shared by the upsert scripts.
+//
+// addEdge creates the edge d on the vertex v. When the other side of the
+// edge doesn't exist it is created with the _missing property, it will
+// eventually be updated later. findEdge returns the edge of v with the
+// same vertices, label and properties than d.
+const edgeClosures = `
+def edgeProperties = { e ->
+	e.properties().collectEntries { [(it.key()): it.value()] }
+}
+def setEdgeProperties = { e, d ->
+	e.properties().each { it.remove() }
+	d['properties'].each { name, value -> e.property(name, value) }
+	e
+}
+def addEdge = { v, d ->
+	def outgoing = d['outV'] == v.id().toString()
+	def otherID = outgoing ? d['inV'] : d['outV']
+	def otherLabel = outgoing ? d['inVLabel'] : d['outVLabel']
+	def other = g.V(otherID).tryNext().orElseGet {
+		g.addV(otherLabel)
+		 .property(id, otherID)
+		 .property('fq_name', ['_missing'])
+		 .property('_missing', true)
+		 .property('deleted', 0)
+		 .next()
+	}
+	setEdgeProperties(outgoing ? v.addEdge(d['label'], other) : other.addEdge(d['label'], v), d)
+}
+def findEdge = { v, d ->
+	v.edges(Direction.BOTH, d['label']).find { e ->
+		e.outVertex().id().toString() == d['outV'] &&
+		e.inVertex().id().toString() == d['inV'] &&
+		edgeProperties(e) == d['properties']
+	}
+}
+`
+
+// upsertScript creates or updates each vertex of the _vertices binding.
+//
+// Properties of existing vertices are replaced. Edges of the vertex are
+// compared with the current edges in the graph like NewEdgeDiff does:
+// edges with the same key and properties are kept, missing edges are
+// added, other edges with the same key get their properties replaced and
+// edges that are not on the vertex anymore are dropped. The properties
+// of an in-edge belong to the other vertex: an existing in-edge with
+// the same key is kept as is. When the edges of a vertex are null its
+// current edges are kept, and likewise for its properties.
+const upsertScript = edgeClosures + `
+def transactional = g.getGraph().features().graph().supportsTransactions()
+try {
+	_vertices.each { data ->
+		def v = g.V(data['id']).tryNext().orElse(null)
+		if (v == null) {
+			v = g.addV(data['label']).property(id, data['id']).next()
+		} else if (data['properties'] != null) {
+			v.properties().each { it.remove() }
+		}
+		data['properties']?.each { name, values ->
+			values.each { value ->
+				v.property(values.size() > 1 ? list : single, name, value)
+			}
+		}
+		if (data['edges'] == null) {
+			return
+		}
+
+		def current = [:]
+		v.edges(Direction.BOTH).each { e ->
+			def key = [e.outVertex().id().toString(), e.inVertex().id().toString(), e.label()].join(' ')
+			current[key] = (current[key] ?: []) << e
+		}
+		def unmatched = []
+		data['edges'].each { d ->
+			def candidates = current[[d['outV'], d['inV'], d['label']].join(' ')] ?: []
+			def incoming = d['outV'] != v.id().toString()
+			def e = candidates.find { incoming || edgeProperties(it) == d['properties'] }
+			if (e == null) {
+				unmatched << d
+			} else {
+				candidates.remove(e)
+			}
+		}
+		unmatched.each { d ->
+			def candidates = current[[d['outV'], d['inV'], d['label']].join(' ')]
+			def e = candidates ? candidates.remove(0) : null
+			if (e == null) {
+				addEdge(v, d)
+			} else {
+				setEdgeProperties(e, d)
+			}
+		}
+		current.values().flatten().each { it.remove() }
+	}
+	if (transactional) {
+		g.tx().commit()
+	}
+} catch (e) {
+	if (transactional) {
+		g.tx().rollback()
+	}
+	throw e
+}
+null
+`
+
+// edgeOpsScript applies the _ops binding to the edges of the vertex
+// _id. It is used for vertices that have too many edges to be sent
+// in a single upsertScript request.
+const edgeOpsScript = edgeClosures + `
+def transactional = g.getGraph().features().graph().supportsTransactions()
+try {
+	def v = g.V(_id).next()
+	_ops.each { op ->
+		switch (op['op']) {
+		case 'add':
+			addEdge(v, op['edge'])
+			break
+		case 'update':
+			def e = findEdge(v, op['current'])
+			if (e == null) {
+				addEdge(v, op['edge'])
+			} else {
+				setEdgeProperties(e, op['edge'])
+			}
+			break
+		case 'remove':
+			findEdge(v, op['edge'])?.remove()
+			break
+		}
+	}
+	if (transactional) {
+		g.tx().commit()
+	}
+} catch (e) {
+	if (transactional) {
+		g.tx().rollback()
+	}
+	throw e
+}
+null
+`
+
+type upsertEdge struct {
+	Label      string                 `json:"label"`
+	OutV       uuid.UUID              `json:"outV"`
+	OutVLabel  string                 `json:"outVLabel"`
+	InV        uuid.UUID              `json:"inV"`
+	InVLabel   string                 `json:"inVLabel"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// edgeOp is an operation of edgeOpsScript, Current is
+// the edge changed by an update
+type edgeOp struct {
+	Op      string      `json:"op"`
+	Edge    upsertEdge  `json:"edge"`
+	Current *upsertEdge `json:"current,omitempty"`
+}
+
+type upsertVertex struct {
+	ID         uuid.UUID                `json:"id"`
+	Label      string                   `json:"label"`
+	Properties map[string][]interface{} `json:"properties"`
+	Edges      []upsertEdge             `json:"edges"`
+}
+
+func newUpsertEdge(e Edge) upsertEdge {
+	ue := upsertEdge{
+		Label:      e.Label,
+		OutV:       e.OutV,
+		OutVLabel:  e.OutVLabel,
+		InV:        e.InV,
+		InVLabel:   e.InVLabel,
+		Properties: make(map[string]interface{}),
+	}
+	for name, prop := range e.Properties {
+		// gremlin does not allow null values in edge properties
+		if prop.Value != nil {
+			ue.Properties[name] = prop.Value
+		}
+	}
+	return ue
+}
+
+func newUpsertVertex(v Vertex) upsertVertex {
+	uv := upsertVertex{
+		ID:         v.ID,
+		Label:      v.Label,
+		Properties: make(map[string][]interface{}),
+		Edges:      make([]upsertEdge, 0),
+	}
+	for name, propList := range v.Properties {
+		values := make([]interface{}, len(propList))
+		for i, prop := range propList {
+			values[i] = prop.Value
+		}
+		uv.Properties[name] = values
+	}
+	for _, e := range v.Edges() {
+		uv.Edges = append(uv.Edges, newUpsertEdge(e))
+	}
+	return uv
+}
+
+// newEdgeOps returns the operations of edgeOpsScript for d.
+// Edges are removed first, then updated and added.
+func newEdgeOps(d EdgeDiff) []edgeOp {
+	ops := make([]edgeOp, 0, len(d.Remove)+len(d.Update)+len(d.Add))
+	for _, e := range d.Remove {
+		ops = append(ops, edgeOp{Op: "remove", Edge: newUpsertEdge(e)})
+	}
+	for i, e := range d.Update {
+		current := newUpsertEdge(d.Replaced[i])
+		ops = append(ops, edgeOp{Op: "update", Edge: newUpsertEdge(e), Current: &current})
+	}
+	for _, e := range d.Add {
+		ops = append(ops, edgeOp{Op: "add", Edge: newUpsertEdge(e)})
+	}
+	return ops
+}
@@ -46,3 +46,54 @@ type Network struct {
 	CreatedAt           string      `json:"created_at"`
 	UpdatedAt           string      `json:"updated_at"`
 }
+
+type AllocationPool struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type HostRoute struct {
+	Destination string `json:"destination"`
+	NextHop     string `json:"nexthop"`
+}
+
+type Subnet struct {
+	ID              uuid.UUID        `json:"id"`
+	TenantID        string           `json:"tenant_id"`
+	NetworkID       uuid.UUID        `json:"network_id"`
+	Name            string           `json:"name"`
+	CIDR            string           `json:"cidr"`
+	GatewayIP       *string          `json:"gateway_ip"`
+	AllocationPools []AllocationPool `json:"allocation_pools"`
+	DNSNameservers  []string         `json:"dns_nameservers"`
+	HostRoutes      []HostRoute      `json:"host_routes"`
+	EnableDHCP      bool             `json:"enable_dhcp"`
+	IPVersion       int              `json:"ip_version"`
+	CreatedAt       string           `json:"created_at"`
+	UpdatedAt       string           `json:"updated_at"`
+}
+
+type SecurityGroupRule struct {
+	ID              uuid.UUID  `json:"id"`
+	TenantID        string     `json:"tenant_id"`
+	SecurityGroupID uuid.UUID  `json:"security_group_id"`
+	Direction       string     `json:"direction"`
+	Ethertype       string     `json:"ethertype"`
+	Protocol        *string    `json:"protocol"`
+	PortRangeMin    *int       `json:"port_range_min"`
+	PortRangeMax    *int       `json:"port_range_max"`
+	RemoteGroupID   *uuid.UUID `json:"remote_group_id"`
+	RemoteIPPrefix  *string    `json:"remote_ip_prefix"`
+	CreatedAt       string     `json:"created_at"`
+	UpdatedAt       string     `json:"updated_at"`
+}
+
+type SecurityGroup struct {
+	ID          uuid.UUID           `json:"id"`
+	TenantID    string              `json:"tenant_id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Rules       []SecurityGroupRule `json:"security_group_rules"`
+	CreatedAt   string              `json:"created_at"`
+	UpdatedAt   string              `json:"updated_at"`
+}
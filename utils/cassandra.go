@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	cli "github.com/jawher/mow.cli"
+	"github.com/willfaught/gockle"
+)
+
+const (
+	// DefaultPageSize is the default number of rows fetched
+	// per page when iterating over cassandra tables
+	DefaultPageSize = 5000
+	// DefaultKeyspace is the keyspace of contrail resources
+	DefaultKeyspace = "config_db_uuid"
+)
+
+// CassandraConfig is the configuration of the cassandra connection
+type CassandraConfig struct {
+	Servers  []string
+	Port     int
+	Keyspace string
+	Username string
+	Password string
+	// TLS is enabled when TLS or one of the TLS paths is set
+	TLS            bool
+	CertPath       string
+	KeyPath        string
+	CAPath         string
+	VerifyHost     bool
+	Consistency    string
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	PageSize       int
+	// HostPolicy is round-robin, token-aware or dc-aware
+	HostPolicy string
+	LocalDC    string
+	// HostLookup discovers the other nodes of the cluster
+	HostLookup bool
+}
+
+// NewCassandraConfig returns the default configuration
+// to connect to the given servers
+func NewCassandraConfig(servers []string) CassandraConfig {
+	return CassandraConfig{
+		Servers:        servers,
+		Port:           9042,
+		Keyspace:       DefaultKeyspace,
+		Consistency:    "QUORUM",
+		Timeout:        2000 * time.Millisecond,
+		ConnectTimeout: 2000 * time.Millisecond,
+		PageSize:       DefaultPageSize,
+		HostPolicy:     "round-robin",
+	}
+}
+
+// CassandraOptions adds the options of the cassandra connection to app.
+// envPrefix is the prefix of the env variables of the options (eg:
+// GREMLIN_DUMP). The returned function gives the configuration once
+// the options are parsed.
+func CassandraOptions(app *cli.Cli, envPrefix string) func() (CassandraConfig, error) {
+	d := NewCassandraConfig([]string{"localhost"})
+	servers := app.Strings(cli.StringsOpt{
+		Name:   "cassandra",
+		Value:  d.Servers,
+		Desc:   "list of host of cassandra nodes",
+		EnvVar: envPrefix + "_CASSANDRA_SERVERS",
+	})
+	port := app.Int(cli.IntOpt{
+		Name:   "cassandra-port",
+		Value:  d.Port,
+		Desc:   "CQL port of cassandra nodes",
+		EnvVar: envPrefix + "_CASSANDRA_PORT",
+	})
+	keyspace := app.String(cli.StringOpt{
+		Name:   "cassandra-keyspace",
+		Value:  d.Keyspace,
+		Desc:   "keyspace of contrail resources",
+		EnvVar: envPrefix + "_CASSANDRA_KEYSPACE",
+	})
+	username := app.String(cli.StringOpt{
+		Name:   "cassandra-user",
+		Value:  "",
+		Desc:   "user for cassandra authentication, empty to disable",
+		EnvVar: envPrefix + "_CASSANDRA_USER",
+	})
+	password := app.String(cli.StringOpt{
+		Name:   "cassandra-password",
+		Value:  "",
+		Desc:   "password for cassandra authentication",
+		EnvVar: envPrefix + "_CASSANDRA_PASSWORD",
+	})
+	tls := app.Bool(cli.BoolOpt{
+		Name:   "cassandra-tls",
+		Value:  false,
+		Desc:   "connect to cassandra with TLS",
+		EnvVar: envPrefix + "_CASSANDRA_TLS",
+	})
+	certPath := app.String(cli.StringOpt{
+		Name:   "cassandra-cert",
+		Value:  "",
+		Desc:   "path of the client certificate",
+		EnvVar: envPrefix + "_CASSANDRA_CERT",
+	})
+	keyPath := app.String(cli.StringOpt{
+		Name:   "cassandra-key",
+		Value:  "",
+		Desc:   "path of the client certificate key",
+		EnvVar: envPrefix + "_CASSANDRA_KEY",
+	})
+	caPath := app.String(cli.StringOpt{
+		Name:   "cassandra-ca",
+		Value:  "",
+		Desc:   "path of the CA certificate of cassandra nodes",
+		EnvVar: envPrefix + "_CASSANDRA_CA",
+	})
+	verifyHost := app.Bool(cli.BoolOpt{
+		Name:   "cassandra-verify-host",
+		Value:  false,
+		Desc:   "check that cassandra certificates match the node hostnames",
+		EnvVar: envPrefix + "_CASSANDRA_VERIFY_HOST",
+	})
+	consistency := app.String(cli.StringOpt{
+		Name:   "cassandra-consistency",
+		Value:  d.Consistency,
+		Desc:   "consistency of cassandra queries (eg: QUORUM, LOCAL_QUORUM, LOCAL_ONE)",
+		EnvVar: envPrefix + "_CASSANDRA_CONSISTENCY",
+	})
+	timeout := app.String(cli.StringOpt{
+		Name:   "cassandra-timeout",
+		Value:  d.Timeout.String(),
+		Desc:   "timeout of cassandra queries",
+		EnvVar: envPrefix + "_CASSANDRA_TIMEOUT",
+	})
+	connectTimeout := app.String(cli.StringOpt{
+		Name:   "cassandra-connect-timeout",
+		Value:  d.ConnectTimeout.String(),
+		Desc:   "timeout of connections to cassandra nodes",
+		EnvVar: envPrefix + "_CASSANDRA_CONNECT_TIMEOUT",
+	})
+	pageSize := app.Int(cli.IntOpt{
+		Name:   "cassandra-page-size",
+		Value:  d.PageSize,
+		Desc:   "number of rows fetched per cassandra page",
+		EnvVar: envPrefix + "_CASSANDRA_PAGE_SIZE",
+	})
+	hostPolicy := app.String(cli.StringOpt{
+		Name:   "cassandra-host-policy",
+		Value:  d.HostPolicy,
+		Desc:   "selection of the cassandra node of a query (round-robin, token-aware or dc-aware)",
+		EnvVar: envPrefix + "_CASSANDRA_HOST_POLICY",
+	})
+	localDC := app.String(cli.StringOpt{
+		Name:   "cassandra-local-dc",
+		Value:  "",
+		Desc:   "datacenter of the nodes selected by the dc-aware policy, also used by the token-aware policy",
+		EnvVar: envPrefix + "_CASSANDRA_LOCAL_DC",
+	})
+	hostLookup := app.Bool(cli.BoolOpt{
+		Name:   "cassandra-host-lookup",
+		Value:  false,
+		Desc:   "discover the other nodes of the cluster",
+		EnvVar: envPrefix + "_CASSANDRA_HOST_LOOKUP",
+	})
+	return func() (CassandraConfig, error) {
+		c := CassandraConfig{
+			Servers:     *servers,
+			Port:        *port,
+			Keyspace:    *keyspace,
+			Username:    *username,
+			Password:    *password,
+			TLS:         *tls,
+			CertPath:    *certPath,
+			KeyPath:     *keyPath,
+			CAPath:      *caPath,
+			VerifyHost:  *verifyHost,
+			Consistency: *consistency,
+			PageSize:    *pageSize,
+			HostPolicy:  *hostPolicy,
+			LocalDC:     *localDC,
+			HostLookup:  *hostLookup,
+		}
+		var err error
+		if c.Timeout, err = time.ParseDuration(*timeout); err != nil {
+			return c, fmt.Errorf("invalid cassandra timeout: %s", err)
+		}
+		if c.ConnectTimeout, err = time.ParseDuration(*connectTimeout); err != nil {
+			return c, fmt.Errorf("invalid cassandra connect timeout: %s", err)
+		}
+		return c, nil
+	}
+}
+
+func (c CassandraConfig) hostPolicy() (gocql.HostSelectionPolicy, error) {
+	fallback := gocql.RoundRobinHostPolicy()
+	if c.LocalDC != "" {
+		fallback = gocql.DCAwareRoundRobinPolicy(c.LocalDC)
+	}
+	switch c.HostPolicy {
+	case "round-robin", "":
+		return gocql.RoundRobinHostPolicy(), nil
+	case "token-aware":
+		return gocql.TokenAwareHostPolicy(fallback), nil
+	case "dc-aware":
+		if c.LocalDC == "" {
+			return nil, fmt.Errorf("the dc-aware policy needs a local datacenter")
+		}
+		return fallback, nil
+	default:
+		return nil, fmt.Errorf("unknown host policy %s", c.HostPolicy)
+	}
+}
+
+// clusterConfig returns the gocql configuration of c
+func (c CassandraConfig) clusterConfig() (*gocql.ClusterConfig, error) {
+	cluster := gocql.NewCluster(c.Servers...)
+	cluster.Port = c.Port
+	cluster.Keyspace = c.Keyspace
+	consistency, err := gocql.ParseConsistencyWrapper(c.Consistency)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Consistency = consistency
+	cluster.Timeout = c.Timeout
+	cluster.ConnectTimeout = c.ConnectTimeout
+	cluster.PageSize = c.PageSize
+	cluster.DisableInitialHostLookup = !c.HostLookup
+	policy, err := c.hostPolicy()
+	if err != nil {
+		return nil, err
+	}
+	cluster.PoolConfig.HostSelectionPolicy = policy
+	if c.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: c.Username,
+			Password: c.Password,
+		}
+	}
+	if c.TLS || c.CertPath != "" || c.KeyPath != "" || c.CAPath != "" {
+		cluster.SslOpts = &gocql.SslOptions{
+			CertPath:               c.CertPath,
+			KeyPath:                c.KeyPath,
+			CaPath:                 c.CAPath,
+			EnableHostVerification: c.VerifyHost,
+		}
+	}
+	return cluster, nil
+}
+
+func SetupCassandra(config CassandraConfig) (gockle.Session, error) {
+	cluster, err := config.clusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	mockableSession := gockle.NewSession(session)
+	return mockableSession, err
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthOK is the status of a healthy component
+	HealthOK = "ok"
+	// HealthError is the status of a failing component
+	HealthError = "error"
+)
+
+// HealthCheck checks a dependency of the process
+type HealthCheck struct {
+	Name  string
+	Check func() error
+	// Optional checks are reported but a failure
+	// doesn't change the status of the process
+	Optional bool
+}
+
+// FailingFor wraps check so that it fails only when check keeps
+// failing for longer than d. It is used to check connections that
+// are reestablished automatically.
+func FailingFor(check func() error, d time.Duration) func() error {
+	var (
+		lock  sync.Mutex
+		since time.Time
+	)
+	return func() error {
+		err := check()
+		lock.Lock()
+		defer lock.Unlock()
+		if err == nil {
+			since = time.Time{}
+			return nil
+		}
+		if since.IsZero() {
+			since = time.Now()
+		}
+		if time.Since(since) < d {
+			return nil
+		}
+		return err
+	}
+}
+
+// Cached wraps check so that it runs at most once every d,
+// the last result is returned meanwhile
+func Cached(check func() error, d time.Duration) func() error {
+	var (
+		lock    sync.Mutex
+		checked time.Time
+		err     error
+	)
+	return func() error {
+		lock.Lock()
+		defer lock.Unlock()
+		if checked.IsZero() || time.Since(checked) >= d {
+			err = check()
+			checked = time.Now()
+		}
+		return err
+	}
+}
+
+// ComponentHealth is the status of a component
+type ComponentHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health is the status of the process and its components
+type Health struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// CheckHealth runs the checks and returns the health of the process
+func CheckHealth(checks []HealthCheck) Health {
+	h := Health{
+		Status:     HealthOK,
+		Components: make(map[string]ComponentHealth, len(checks)),
+	}
+	for _, c := range checks {
+		if err := c.Check(); err != nil {
+			h.Components[c.Name] = ComponentHealth{Status: HealthError, Error: err.Error()}
+			if !c.Optional {
+				h.Status = HealthError
+			}
+		} else {
+			h.Components[c.Name] = ComponentHealth{Status: HealthOK}
+		}
+	}
+	return h
+}
+
+// HealthHandler serves the health of the process as JSON.
+// The response status is 503 when a check that is not
+// optional fails.
+func HealthHandler(checks []HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := CheckHealth(checks)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if h.Status != HealthOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(h)
+	}
+}
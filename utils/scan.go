@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/satori/go.uuid"
+	"github.com/willfaught/gockle"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+)
+
+// TokenRange is a range of partition tokens (Start excluded,
+// End included) of the Murmur3 partitioner
+type TokenRange struct {
+	Start int64
+	End   int64
+}
+
+// SplitTokenRing splits the whole token ring in n ranges
+func SplitTokenRing(n int) []TokenRange {
+	if n < 1 {
+		n = 1
+	}
+	var (
+		ranges = make([]TokenRange, n)
+		step   = math.MaxUint64 / uint64(n)
+		start  = int64(math.MinInt64)
+	)
+	for i := 0; i < n; i++ {
+		end := int64(math.MaxInt64)
+		if i < n-1 {
+			end = start + int64(step)
+		}
+		ranges[i] = TokenRange{Start: start, End: end}
+		start = end
+	}
+	return ranges
+}
+
+// ScannedResource is a resource read by ScanContrailResources
+type ScannedResource struct {
+	Vertex g.Vertex
+	// Err is set when the rows of the resource can't be read,
+	// Vertex only has the ID of the resource then
+	Err error
+	// Range is the index of the token range of the resource
+	Range int
+	// Token is the partition token of the resource
+	Token int64
+}
+
+// ScanContrailResources reads obj_uuid_table in parallel token ranges
+// and sends each resource to resources.
+//
+// Rows of a resource are consecutive in a token range, so resources
+// are built without querying each uuid. Resources of a range are sent
+// in token order. Resources that can't be read are sent with their
+// error so that the caller can report them.
+func ScanContrailResources(session gockle.Session, ranges []TokenRange, resources chan ScannedResource) error {
+	var (
+		errs = make(chan error, len(ranges))
+		wg   sync.WaitGroup
+	)
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r TokenRange) {
+			defer wg.Done()
+			errs <- scanTokenRange(session, i, r, resources)
+		}(i, r)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanTokenRange(session gockle.Session, index int, r TokenRange, resources chan ScannedResource) error {
+	var (
+		token   int64
+		last    int64
+		key     []byte
+		column1 []byte
+		value   string
+		current []byte
+		rows    []map[string]interface{}
+	)
+	flush := func() {
+		if len(rows) == 0 {
+			return
+		}
+		defer func() { rows = nil }()
+		rUUID, err := uuid.FromString(string(current))
+		if err != nil {
+			return
+		}
+		vertex, err := newContrailResource(rUUID, rows)
+		if err != nil {
+			vertex = g.Vertex{ID: rUUID}
+			err = fmt.Errorf("Failed to read %s: %s", rUUID, err)
+		}
+		resources <- ScannedResource{
+			Vertex: vertex,
+			Err:    err,
+			Range:  index,
+			Token:  last,
+		}
+	}
+	it := session.ScanIterator(
+		`SELECT token(key), key, column1, value FROM obj_uuid_table WHERE token(key) > ? AND token(key) <= ?`,
+		r.Start, r.End)
+	for it.Scan(&token, &key, &column1, &value) {
+		if !bytes.Equal(key, current) {
+			flush()
+			current = append([]byte{}, key...)
+			last = token
+		}
+		rows = append(rows, map[string]interface{}{
+			"column1": append([]byte{}, column1...),
+			"value":   value,
+		})
+	}
+	flush()
+	return it.Close()
+}
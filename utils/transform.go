@@ -0,0 +1,24 @@
+package utils
+
+import (
+	cli "github.com/jawher/mow.cli"
+
+	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+)
+
+// TransformOptions adds the option enabling the default vertex
+// transformers. The returned function registers them when the
+// option is set, it must be called before reading resources.
+func TransformOptions(app *cli.Cli, envPrefix string) func() {
+	enabled := app.Bool(cli.BoolOpt{
+		Name:   "default-transforms",
+		Value:  false,
+		Desc:   "add the properties of the default vertex transformers (eg: id_perms_enable)",
+		EnvVar: envPrefix + "_DEFAULT_TRANSFORMS",
+	})
+	return func() {
+		if *enabled {
+			g.RegisterDefaultTransformers()
+		}
+	}
+}
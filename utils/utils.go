@@ -7,10 +7,8 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/Jeffail/gabs"
-	"github.com/gocql/gocql"
 	"github.com/satori/go.uuid"
 	"github.com/willfaught/gockle"
 
@@ -22,33 +20,51 @@ var (
 	ErrResourceNotFound = errors.New("resource not found")
 )
 
-func SetupCassandra(cassandraCluster []string) (gockle.Session, error) {
-	cluster := gocql.NewCluster(cassandraCluster...)
-	cluster.Keyspace = "config_db_uuid"
-	cluster.Consistency = gocql.Quorum
-	cluster.Timeout = 2000 * time.Millisecond
-	cluster.DisableInitialHostLookup = true
-	session, err := cluster.CreateSession()
-	if err != nil {
-		return nil, err
-	}
-	mockableSession := gockle.NewSession(session)
-	return mockableSession, err
-}
-
-func GetContrailUUIDs(session gockle.Session, uuids chan uuid.UUID) error {
+// scanFQNames calls f with the parts of each column of
+// obj_fq_name_table: type, fq_name parts and uuid
+func scanFQNames(session gockle.Session, f func(parts []string)) error {
 	var (
 		column1 string
 	)
 	r := session.ScanIterator(`SELECT column1 FROM obj_fq_name_table`)
 	for r.Scan(&column1) {
-		parts := strings.Split(column1, ":")
+		f(strings.Split(column1, ":"))
+	}
+	return r.Close()
+}
+
+func GetContrailUUIDs(session gockle.Session, uuids chan uuid.UUID) error {
+	return scanFQNames(session, func(parts []string) {
 		uuid, err := uuid.FromString(parts[len(parts)-1])
 		if err == nil {
 			uuids <- uuid
 		}
-	}
-	return r.Close()
+	})
+}
+
+// FQNameEntry is a row of obj_fq_name_table
+type FQNameEntry struct {
+	Type   string
+	FQName []string
+	UUID   uuid.UUID
+}
+
+// GetContrailFQNames sends the type, fq_name and uuid of
+// all resources to entries
+func GetContrailFQNames(session gockle.Session, entries chan FQNameEntry) error {
+	return scanFQNames(session, func(parts []string) {
+		if len(parts) < 2 {
+			return
+		}
+		uuid, err := uuid.FromString(parts[len(parts)-1])
+		if err == nil {
+			entries <- FQNameEntry{
+				Type:   parts[0],
+				FQName: parts[1 : len(parts)-1],
+				UUID:   uuid,
+			}
+		}
+	})
 }
 
 func generateEdgeProperties(valueJSON []byte) (map[string]interface{}, bool) {
@@ -89,10 +105,6 @@ func generateVertexProperty(valueJSON []byte) (interface{}, bool) {
 }
 
 func GetContrailResource(session gockle.Session, rUUID uuid.UUID) (g.Vertex, error) {
-	var (
-		column1   string
-		valueJSON []byte
-	)
 	rows, err := session.ScanMapSlice(`SELECT key, column1, value FROM obj_uuid_table WHERE key=?`, rUUID.String())
 	if err != nil {
 		return g.Vertex{}, err
@@ -100,6 +112,49 @@ func GetContrailResource(session gockle.Session, rUUID uuid.UUID) (g.Vertex, err
 	if len(rows) == 0 {
 		return g.Vertex{}, ErrResourceNotFound
 	}
+	return newContrailResource(rUUID, rows)
+}
+
+// GetContrailResourceUpdated reads only the type and id_perms columns
+// of a resource. The returned vertex has the label and the updated
+// property of the resource, it is enough to know if the resource
+// changed without reading all its columns.
+func GetContrailResourceUpdated(session gockle.Session, rUUID uuid.UUID) (g.Vertex, error) {
+	rows, err := session.ScanMapSlice(`SELECT key, column1, value FROM obj_uuid_table WHERE key=? AND column1 IN (?, ?)`,
+		rUUID.String(), []byte("type"), []byte("prop:id_perms"))
+	if err != nil {
+		return g.Vertex{}, err
+	}
+	if len(rows) == 0 {
+		return g.Vertex{}, ErrResourceNotFound
+	}
+	vertex := g.Vertex{
+		ID: rUUID,
+	}
+	for _, row := range rows {
+		valueJSON := []byte(row["value"].(string))
+		switch string(row["column1"].([]byte)) {
+		case "type":
+			json.Unmarshal(valueJSON, &vertex.Label)
+		case "prop:id_perms":
+			if propValue, ok := generateVertexProperty(valueJSON); ok {
+				vertex.AddProperty("id_perms", propValue)
+			}
+		}
+	}
+	if updated, err := vertex.Time("id_perms.last_modified"); err == nil {
+		vertex.AddSingleProperty("updated", updated.Unix())
+	}
+	return vertex, nil
+}
+
+// newContrailResource builds the vertex of a resource
+// from its rows in obj_uuid_table
+func newContrailResource(rUUID uuid.UUID, rows []map[string]interface{}) (g.Vertex, error) {
+	var (
+		column1   string
+		valueJSON []byte
+	)
 	vertex := g.Vertex{
 		ID: rUUID,
 	}
@@ -209,15 +264,11 @@ func GetContrailResource(session gockle.Session, rUUID uuid.UUID) (g.Vertex, err
 	}
 
 	// Add updated/created/deleted properties timestamps
-	if created, ok := vertex.PropertyValue("id_perms.created"); ok {
-		if time, err := time.Parse(time.RFC3339Nano, created.(string)+`Z`); err == nil {
-			vertex.AddSingleProperty("created", time.Unix())
-		}
+	if created, err := vertex.Time("id_perms.created"); err == nil {
+		vertex.AddSingleProperty("created", created.Unix())
 	}
-	if updated, ok := vertex.PropertyValue("id_perms.last_modified"); ok {
-		if time, err := time.Parse(time.RFC3339Nano, updated.(string)+`Z`); err == nil {
-			vertex.AddSingleProperty("updated", time.Unix())
-		}
+	if updated, err := vertex.Time("id_perms.last_modified"); err == nil {
+		vertex.AddSingleProperty("updated", updated.Unix())
 	}
 
 	// Mark the vertex as deleted, but we don't know when it was deleted
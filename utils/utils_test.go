@@ -1,9 +1,16 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	g "github.com/eonpatapon/contrail-gremlin/gremlin"
+	"github.com/gocql/gocql"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/willfaught/gockle"
@@ -96,3 +103,210 @@ func TestGetContrailResourceNoEdges(t *testing.T) {
 
 	assert.Equal(t, expectedVertex, vertex, "")
 }
+
+func TestGetContrailResourceUpdated(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	query := "SELECT key, column1, value FROM obj_uuid_table WHERE key=? AND column1 IN (?, ?)"
+
+	session := &gockle.SessionMock{}
+	session.When("Close").Return()
+	session.When("ScanMapSlice", query, []interface{}{id1.String(), []byte("type"), []byte("prop:id_perms")}).Return(
+		[]map[string]interface{}{
+			{"column1": []byte("prop:id_perms"), "value": `{"last_modified": "2018-03-05T06:21:57.186987"}`},
+			{"column1": []byte("type"), "value": `"foo"`},
+		},
+		nil,
+	)
+	session.When("ScanMapSlice", query, []interface{}{id2.String(), []byte("type"), []byte("prop:id_perms")}).Return(
+		[]map[string]interface{}(nil),
+		nil,
+	)
+
+	vertex, err := GetContrailResourceUpdated(session, id1)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", vertex.Label)
+	updated, _ := vertex.Int64("updated")
+	assert.Equal(t, int64(1520230917), updated)
+
+	_, err = GetContrailResourceUpdated(session, id2)
+	assert.Equal(t, ErrResourceNotFound, err)
+}
+
+func TestHealthHandler(t *testing.T) {
+	checks := []HealthCheck{
+		{Name: "foo", Check: func() error { return nil }},
+		{Name: "bar", Check: func() error { return errors.New("down") }, Optional: true},
+	}
+
+	w := httptest.NewRecorder()
+	HealthHandler(checks)(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var h Health
+	json.Unmarshal(w.Body.Bytes(), &h)
+	assert.Equal(t, Health{
+		Status: HealthOK,
+		Components: map[string]ComponentHealth{
+			"foo": {Status: HealthOK},
+			"bar": {Status: HealthError, Error: "down"},
+		},
+	}, h)
+
+	checks[1].Optional = false
+	w = httptest.NewRecorder()
+	HealthHandler(checks)(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestFailingFor(t *testing.T) {
+	var err error
+	check := FailingFor(func() error { return err }, 50*time.Millisecond)
+	assert.Nil(t, check())
+
+	err = errors.New("down")
+	assert.Nil(t, check())
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, err, check())
+
+	err = nil
+	assert.Nil(t, check())
+	err = errors.New("down")
+	assert.Nil(t, check())
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	check := Cached(func() error {
+		calls++
+		return nil
+	}, 50*time.Millisecond)
+	check()
+	check()
+	assert.Equal(t, 1, calls)
+	time.Sleep(60 * time.Millisecond)
+	check()
+	assert.Equal(t, 2, calls)
+}
+
+func TestSplitTokenRing(t *testing.T) {
+	assert.Equal(t, []TokenRange{{math.MinInt64, math.MaxInt64}}, SplitTokenRing(1))
+	ranges := SplitTokenRing(4)
+	assert.Equal(t, 4, len(ranges))
+	assert.Equal(t, int64(math.MinInt64), ranges[0].Start)
+	assert.Equal(t, int64(math.MaxInt64), ranges[3].End)
+	for i := 1; i < len(ranges); i++ {
+		assert.Equal(t, ranges[i-1].End, ranges[i].Start)
+		assert.True(t, ranges[i].Start < ranges[i].End)
+	}
+}
+
+type rowsIterator struct {
+	rows [][]interface{}
+	idx  *int
+}
+
+func (i rowsIterator) Close() error {
+	return nil
+}
+
+func (i rowsIterator) Scan(results ...interface{}) bool {
+	if *i.idx >= len(i.rows) {
+		return false
+	}
+	row := i.rows[*i.idx]
+	*results[0].(*int64) = row[0].(int64)
+	*results[1].(*[]byte) = row[1].([]byte)
+	*results[2].(*[]byte) = row[2].([]byte)
+	*results[3].(*string) = row[3].(string)
+	*i.idx++
+	return true
+}
+
+func (i rowsIterator) ScanMap(results map[string]interface{}) bool {
+	return false
+}
+
+func TestScanContrailResources(t *testing.T) {
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+	id3, _ := uuid.NewV4()
+
+	g.RegisterTransformer("broken", func(v *g.Vertex) error {
+		return errors.New("broken resource")
+	})
+
+	session := &gockle.SessionMock{}
+	session.When("ScanIterator",
+		"SELECT token(key), key, column1, value FROM obj_uuid_table WHERE token(key) > ? AND token(key) <= ?",
+		[]interface{}{int64(math.MinInt64), int64(math.MaxInt64)}).Return(
+		rowsIterator{
+			rows: [][]interface{}{
+				{int64(-10), []byte(id1.String()), []byte("type"), `"foo"`},
+				{int64(-10), []byte(id1.String()), []byte("fq_name"), `["foo"]`},
+				{int64(20), []byte(id2.String()), []byte("type"), `"bar"`},
+				{int64(20), []byte(id2.String()), []byte("ref:foo:" + id1.String()), `{"attr": null}`},
+				{int64(30), []byte(id3.String()), []byte("type"), `"broken"`},
+			},
+			idx: new(int),
+		},
+	)
+
+	resources := make(chan ScannedResource, 3)
+	err := ScanContrailResources(session, SplitTokenRing(1), resources)
+	assert.Nil(t, err)
+	close(resources)
+
+	var results []ScannedResource
+	for r := range resources {
+		results = append(results, r)
+	}
+	assert.Equal(t, 3, len(results))
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, id1, results[0].Vertex.ID)
+	assert.Equal(t, "foo", results[0].Vertex.Label)
+	assert.Equal(t, int64(-10), results[0].Token)
+	assert.Equal(t, id2, results[1].Vertex.ID)
+	assert.Equal(t, "bar", results[1].Vertex.Label)
+	assert.Equal(t, int64(20), results[1].Token)
+	assert.Equal(t, id1, results[1].Vertex.OutE["ref"][0].InV)
+	// the transformation of the broken resource fails
+	assert.NotNil(t, results[2].Err)
+	assert.Equal(t, id3, results[2].Vertex.ID)
+	assert.Equal(t, int64(30), results[2].Token)
+}
+
+func TestCassandraConfig(t *testing.T) {
+	c := NewCassandraConfig([]string{"node1", "node2"})
+	cluster, err := c.clusterConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "config_db_uuid", cluster.Keyspace)
+	assert.Equal(t, gocql.Quorum, cluster.Consistency)
+	assert.True(t, cluster.DisableInitialHostLookup)
+	assert.Nil(t, cluster.Authenticator)
+	assert.Nil(t, cluster.SslOpts)
+
+	c.Username = "user"
+	c.Password = "pass"
+	c.CAPath = "/etc/ca.pem"
+	c.Consistency = "local_one"
+	c.HostLookup = true
+	cluster, err = c.clusterConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, gocql.LocalOne, cluster.Consistency)
+	assert.False(t, cluster.DisableInitialHostLookup)
+	assert.Equal(t, gocql.PasswordAuthenticator{Username: "user", Password: "pass"}, cluster.Authenticator)
+	assert.Equal(t, "/etc/ca.pem", cluster.SslOpts.CaPath)
+
+	c.Consistency = "foo"
+	_, err = c.clusterConfig()
+	assert.NotNil(t, err)
+
+	c.Consistency = "QUORUM"
+	c.HostPolicy = "dc-aware"
+	_, err = c.clusterConfig()
+	assert.NotNil(t, err)
+	c.LocalDC = "dc1"
+	_, err = c.clusterConfig()
+	assert.Nil(t, err)
+}